@@ -0,0 +1,126 @@
+package route
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// a constraint checks the value of a dynamic segment
+// while the tree is walked. A segment that does not
+// satisfy it does not match the identifier.
+type constraint func(string) bool
+
+// check the escaped value of a segment, which is
+// decoded first when it holds escaped characters
+func (c constraint) check(v string) bool {
+	if strings.IndexByte(v, '%') >= 0 {
+		d, err := url.PathUnescape(v)
+		if err != nil {
+			return false
+		}
+		v = d
+	}
+	return c(v)
+}
+
+// constraints available with the `:name<type>` syntax
+var typeConstraints = map[string]constraint{
+	"int":   isInt,
+	"uint":  isUint,
+	"alpha": isAlpha,
+	"uuid":  isUUID,
+}
+
+// parse a dynamic identifier of a pattern, like `:id`,
+// `:id{[0-9]+}` or `:id<int>`, into its name and constraint.
+// The constraint is nil when the identifier accepts any value.
+func parseDynamic(id string) (string, constraint, error) {
+	name := strings.TrimPrefix(id, ":")
+	var c constraint
+	if i := strings.IndexAny(name, "{<"); i >= 0 {
+		var err error
+		c, err = parseConstraint(name[i:])
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid identifier %s: %w", id, err)
+		}
+		name = name[:i]
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("invalid identifier %s: a dynamic identifier must be named", id)
+	}
+	return name, c, nil
+}
+
+func parseConstraint(spec string) (constraint, error) {
+	if strings.HasPrefix(spec, "{") && strings.HasSuffix(spec, "}") {
+		re, err := regexp.Compile("^(?:" + spec[1:len(spec)-1] + ")$")
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	} else if strings.HasPrefix(spec, "<") && strings.HasSuffix(spec, ">") {
+		c, ok := typeConstraints[spec[1:len(spec)-1]]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s", spec)
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("malformed constraint %s", spec)
+}
+
+func isInt(v string) bool {
+	if strings.HasPrefix(v, "-") {
+		v = v[1:]
+	}
+	return isUint(v)
+}
+
+func isUint(v string) bool {
+	if v == "" {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || v[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(v string) bool {
+	if v == "" {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if (v[i] < 'a' || v[i] > 'z') && (v[i] < 'A' || v[i] > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// canonical textual form, like 123e4567-e89b-12d3-a456-426614174000
+func isUUID(v string) bool {
+	if len(v) != 36 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if v[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(v[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
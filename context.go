@@ -0,0 +1,40 @@
+package route
+
+import (
+	"context"
+	"net/http"
+)
+
+// context given to handlers when the router has a base context.
+// Cancellation and deadline come from the request context, values
+// are looked up in the request context first, then in the base one.
+type mergedContext struct {
+	context.Context
+	base context.Context
+}
+
+func (c mergedContext) Value(key interface{}) interface{} {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+	return c.base.Value(key)
+}
+
+// SetBaseContext register a context whose values are made
+// available to every handler, for instance a db pool or a logger
+// stored by the application. Its cancellation is not propagated,
+// handlers are only cancelled with their request.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) SetBaseContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// build the context of a handler from the incoming request
+func (r *DynamicRouter) handlerContext(req *http.Request, ps params) context.Context {
+	ctx := req.Context()
+	if r.ctx != nil {
+		ctx = mergedContext{Context: ctx, base: r.ctx}
+	}
+	return withParams(ctx, ps)
+}
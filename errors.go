@@ -0,0 +1,45 @@
+package route
+
+import "errors"
+
+var (
+	// ErrInvalidPattern is returned when registering a route
+	// whose pattern, host or methods are malformed.
+	ErrInvalidPattern = errors.New("invalid pattern")
+	// ErrInvalidRoute is returned when registering a route
+	// without handler.
+	ErrInvalidRoute = errors.New("invalid route")
+	// ErrDuplicateRoute is returned when registering a route
+	// whose pattern and method, or name, are already registered.
+	ErrDuplicateRoute = errors.New("duplicate route")
+	// ErrParamConflict is returned when registering a route whose
+	// dynamic or wildcard identifier clashes with another one
+	// registered at the same level.
+	ErrParamConflict = errors.New("parameter conflict")
+)
+
+// RouteError describes why a route could not be registered.
+// It wraps one of ErrInvalidPattern, ErrInvalidRoute,
+// ErrDuplicateRoute or ErrParamConflict, or ErrUnknownRoute
+// when the route to remove does not exist.
+type RouteError struct {
+	Err error
+	// Pattern of the route being registered
+	Pattern string
+	// Conflict is the pattern of the registered
+	// route clashing with the new one, if any
+	Conflict string
+	Reason   string
+}
+
+func (e *RouteError) Error() string {
+	msg := e.Pattern + ": " + e.Reason
+	if e.Conflict != "" {
+		msg += " (conflicts with " + e.Conflict + ")"
+	}
+	return msg
+}
+
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,150 @@
+package route
+
+import "net/http"
+
+// Group registers routes sharing a path prefix and some filters.
+// The routes are added to the tree of the DynamicRouter that
+// created the Group, so matching them costs the same as any
+// other route.
+type Group struct {
+	router  *DynamicRouter
+	host    string
+	prefix  string
+	filters []HttpFilter
+	// context filters run before the ones of the routes
+	contextFilters []ContextFilter
+}
+
+// Group create a Group whose routes will have the given prefix
+// prepended to their pattern, and the given filters run before
+// their own ones.
+func (r *DynamicRouter) Group(prefix string, filters ...HttpFilter) *Group {
+	return &Group{router: r, prefix: prefix, filters: filters}
+}
+
+// Group create a nested Group. Its prefix and filters are
+// appended to the ones of g.
+func (g *Group) Group(prefix string, filters ...HttpFilter) *Group {
+	return &Group{router: g.router, host: g.host, prefix: g.pattern(prefix), filters: g.with(filters), contextFilters: g.contextFilters}
+}
+
+// WithContextFilters create a Group with the same prefix and
+// filters than g, whose routes also run the given context filters
+// before their own ones. g is left unchanged.
+func (g *Group) WithContextFilters(filters ...ContextFilter) *Group {
+	c := *g
+	c.contextFilters = g.withContext(filters)
+	return &c
+}
+
+// HandleFunc register a new Handler for a given pattern and every http method
+func (g *Group) HandleFunc(pattern string, handler Handler, filters ...HttpFilter) {
+	g.router.mustRegister(g.host, g.route(Route{Pattern: pattern, Handler: handler, Filters: filters}))
+}
+
+// Handle register a new Handler for a given http method and pattern
+func (g *Group) Handle(method, pattern string, handler Handler, filters ...HttpFilter) {
+	g.router.mustRegister(g.host, g.route(Route{Methods: []string{method}, Pattern: pattern, Handler: handler, Filters: filters}))
+}
+
+// HandleRoute register a new Route, its pattern and
+// filters being prepended with the ones of the group.
+func (g *Group) HandleRoute(rt Route) {
+	g.router.mustRegister(g.host, g.route(rt))
+}
+
+// Register register a new Route like HandleRoute, but returns
+// a *RouteError instead of panicking.
+func (g *Group) Register(rt Route) error {
+	return g.router.register(g.host, g.route(rt))
+}
+
+// TryHandleFunc register a new Handler for a given pattern and every
+// http method, returning a *RouteError instead of panicking.
+func (g *Group) TryHandleFunc(pattern string, handler Handler, filters ...HttpFilter) error {
+	return g.router.register(g.host, g.route(Route{Pattern: pattern, Handler: handler, Filters: filters}))
+}
+
+// Remove unregister the handler of a http method on a pattern
+// of the group, like DynamicRouter.Remove.
+func (g *Group) Remove(method, pattern string) error {
+	return g.router.remove(g.host, method, g.pattern(pattern))
+}
+
+// Replace register a new Route of the group, replacing the handlers
+// registered for the same methods and pattern, like DynamicRouter.Replace.
+func (g *Group) Replace(rt Route) error {
+	return g.router.replace(g.host, g.route(rt))
+}
+
+// Get register a new Handler for GET requests on a given pattern
+func (g *Group) Get(pattern string, handler Handler, filters ...HttpFilter) {
+	g.Handle(http.MethodGet, pattern, handler, filters...)
+}
+
+// Head register a new Handler for HEAD requests on a given pattern
+func (g *Group) Head(pattern string, handler Handler, filters ...HttpFilter) {
+	g.Handle(http.MethodHead, pattern, handler, filters...)
+}
+
+// Post register a new Handler for POST requests on a given pattern
+func (g *Group) Post(pattern string, handler Handler, filters ...HttpFilter) {
+	g.Handle(http.MethodPost, pattern, handler, filters...)
+}
+
+// Put register a new Handler for PUT requests on a given pattern
+func (g *Group) Put(pattern string, handler Handler, filters ...HttpFilter) {
+	g.Handle(http.MethodPut, pattern, handler, filters...)
+}
+
+// Patch register a new Handler for PATCH requests on a given pattern
+func (g *Group) Patch(pattern string, handler Handler, filters ...HttpFilter) {
+	g.Handle(http.MethodPatch, pattern, handler, filters...)
+}
+
+// Delete register a new Handler for DELETE requests on a given pattern
+func (g *Group) Delete(pattern string, handler Handler, filters ...HttpFilter) {
+	g.Handle(http.MethodDelete, pattern, handler, filters...)
+}
+
+// Options register a new Handler for OPTIONS requests on a given pattern
+func (g *Group) Options(pattern string, handler Handler, filters ...HttpFilter) {
+	g.Handle(http.MethodOptions, pattern, handler, filters...)
+}
+
+// prepend the prefix and the filters of the group to a route
+func (g *Group) route(rt Route) Route {
+	rt.Pattern = g.pattern(rt.Pattern)
+	rt.Filters = g.with(rt.Filters)
+	rt.ContextFilters = g.withContext(rt.ContextFilters)
+	return rt
+}
+
+// prepend the prefix of the group to a pattern. Empty parts
+// of the result are ignored when the pattern is parsed, but
+// an empty pattern does not add a trailing slash.
+func (g *Group) pattern(pattern string) string {
+	if pattern == "" && g.prefix != "" {
+		return g.prefix
+	}
+	return g.prefix + "/" + pattern
+}
+
+// prepend the filters of the group to the given ones,
+// without sharing the underlying array
+func (g *Group) with(filters []HttpFilter) []HttpFilter {
+	all := make([]HttpFilter, 0, len(g.filters)+len(filters))
+	all = append(all, g.filters...)
+	return append(all, filters...)
+}
+
+// prepend the context filters of the group to the given
+// ones, without sharing the underlying array
+func (g *Group) withContext(filters []ContextFilter) []ContextFilter {
+	if len(g.contextFilters) == 0 {
+		return filters
+	}
+	all := make([]ContextFilter, 0, len(g.contextFilters)+len(filters))
+	all = append(all, g.contextFilters...)
+	return append(all, filters...)
+}
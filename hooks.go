@@ -0,0 +1,92 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// PanicHandler is called when a handler or a filter panics, with
+// the recovered value and the stack trace of the panic. The response
+// written by the panicking handler is dropped, the PanicHandler is
+// responsible for the whole response. It is not called when a part
+// of the response has already been sent, see SetBufferLimit.
+type PanicHandler func(ctx context.Context, w http.ResponseWriter, r *http.Request, recovered interface{}, stack []byte)
+
+// SetNotFoundHandler register the Handler serving the requests
+// matching no route, instead of an empty 404 response. The file
+// server, when there is one, is used instead.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) SetNotFoundHandler(handler Handler) {
+	r.notFoundHandler = handler
+}
+
+// SetMethodNotAllowedHandler register the Handler serving the requests
+// matching a route but none of its methods, instead of an empty 405
+// response. The Allow header is already set when it is called.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) SetMethodNotAllowedHandler(handler Handler) {
+	r.methodNotAllowedHandler = handler
+}
+
+// SetPanicHandler register the PanicHandler called when
+// a request panics, instead of an empty 500 response.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) SetPanicHandler(handler PanicHandler) {
+	r.panicHandler = handler
+}
+
+// the Handler of the requests matching no route
+func (r *DynamicRouter) notFound(w *responseWrapper) Handler {
+	if r.fileServer != nil {
+		return func(ctx context.Context, res http.ResponseWriter, req *http.Request) {
+			// files may be large, they are not buffered
+			w.stream()
+			r.fileServer.ServeHTTP(res, req)
+		}
+	} else if r.notFoundHandler != nil {
+		return r.notFoundHandler
+	}
+	return statusHandler(http.StatusNotFound)
+}
+
+// the Handler of the requests matching a route but none of its methods
+func (r *DynamicRouter) methodNotAllowed(allowed []string) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.methodNotAllowedHandler != nil {
+			r.methodNotAllowedHandler(ctx, w, req)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// must be deferred by ServeHTTP, ps being the params
+// of the request once they are known
+func (r *DynamicRouter) recoverPanic(w *responseWrapper, req *http.Request, ps *params) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	} else if w.sent {
+		// the response cannot be replaced anymore, net/http
+		// logs the panic and aborts the connection
+		panic(recovered)
+	}
+	// nothing has been sent, the response of the handler is dropped
+	w.reset()
+	if r.panicHandler == nil {
+		// we dunno what's happened so, we set the
+		// status code to 500
+		w.WriteHeader(http.StatusInternalServerError)
+		w.flush()
+		return
+	}
+	stack := debug.Stack()
+	r.panicHandler(r.handlerContext(req, *ps), w.writer(), req, recovered, stack)
+	w.flush()
+}
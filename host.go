@@ -0,0 +1,134 @@
+package route
+
+import (
+	"errors"
+	"strings"
+)
+
+// a label of a host pattern
+type hostLabel struct {
+	kind  nodeKind
+	value string // static label, or name of a dynamic one
+}
+
+// routes registered for the hosts matching a pattern
+type hostTree struct {
+	pattern string
+	labels  []hostLabel
+	// for wildcard patterns, the static labels following
+	// the wildcard one, with their leading dot
+	suffix string
+	root   *node
+}
+
+// parseHost validates a host pattern and split it into labels.
+//
+// A label may be static, like `api`, dynamic, like `:tenant`, or a
+// wildcard `*` matching one or more labels. The wildcard is only
+// allowed as the first label of a pattern otherwise static.
+func parseHost(pattern string) (*hostTree, error) {
+	if pattern == "" {
+		return nil, errors.New("host cannot be empty")
+	}
+	h := &hostTree{pattern: pattern, root: newNode()}
+	for i, l := range strings.Split(strings.TrimSuffix(pattern, "."), ".") {
+		switch {
+		case l == "":
+			return nil, errors.New("a host cannot have an empty label")
+		case l == "*":
+			if i != 0 {
+				return nil, errors.New("a wildcard label must be the first one of the host")
+			}
+			h.labels = append(h.labels, hostLabel{kind: wildcardNode})
+		case strings.HasPrefix(l, ":"):
+			if l == ":" {
+				return nil, errors.New("a dynamic label must be named")
+			}
+			h.labels = append(h.labels, hostLabel{kind: dynamicNode, value: l[1:]})
+		default:
+			h.labels = append(h.labels, hostLabel{kind: staticNode, value: strings.ToLower(l)})
+		}
+	}
+	if h.labels[0].kind == wildcardNode {
+		for _, l := range h.labels[1:] {
+			if l.kind != staticNode {
+				return nil, errors.New("a wildcard host cannot have dynamic labels")
+			}
+			h.suffix += "." + l.value
+		}
+	}
+	return h, nil
+}
+
+// precedence of the pattern, lower is tried first.
+// Exact hosts come first, then the ones with dynamic
+// labels, then the wildcard ones.
+func (h *hostTree) precedence() int {
+	if h.labels[0].kind == wildcardNode {
+		return 2
+	}
+	for _, l := range h.labels {
+		if l.kind == dynamicNode {
+			return 1
+		}
+	}
+	return 0
+}
+
+// check whether host, without port, matches the pattern.
+// The dynamic labels are appended to ps on success.
+func (h *hostTree) match(host string, ps *params) bool {
+	if h.labels[0].kind == wildcardNode {
+		return len(host) > len(h.suffix) && strings.EqualFold(host[len(host)-len(h.suffix):], h.suffix)
+	}
+	mark := len(*ps)
+	rest := host
+	for i, l := range h.labels {
+		label := rest
+		if i < len(h.labels)-1 {
+			end := strings.IndexByte(rest, '.')
+			if end < 0 {
+				*ps = (*ps)[:mark]
+				return false
+			}
+			label, rest = rest[:end], rest[end+1:]
+		}
+		if l.kind == staticNode && !strings.EqualFold(label, l.value) ||
+			l.kind == dynamicNode && (label == "" || strings.IndexByte(label, '.') >= 0) {
+			*ps = (*ps)[:mark]
+			return false
+		} else if l.kind == dynamicNode {
+			*ps = append(*ps, param{key: l.value, value: label})
+		}
+	}
+	return true
+}
+
+// remove the port and the trailing dot of a request host
+func stripPort(host string) string {
+	if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') {
+		host = host[:i]
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// Host create a Group whose routes are only served for
+// the requests whose host matches the given pattern.
+//
+// Patterns may be exact hosts, like `api.example.com`, wildcard
+// subdomains, like `*.example.com`, or have dynamic labels, like
+// `:tenant.example.com`. Dynamic labels are available to handlers
+// the same way as path parameters, with Param and Params.
+//
+// Exact patterns are tried first, then the ones with dynamic labels,
+// then the wildcard ones. Once a pattern matches the host of a request,
+// only its routes are considered. The routes registered directly on the
+// DynamicRouter serve the requests matching no host pattern.
+//
+// A whole tree is served for a host by mounting it at `/`.
+func (r *DynamicRouter) Host(pattern string) *Group {
+	if _, err := parseHost(pattern); err != nil {
+		panic(err.Error())
+	}
+	return &Group{router: r, host: pattern}
+}
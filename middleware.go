@@ -0,0 +1,119 @@
+package route
+
+import (
+	"context"
+	"net/http"
+)
+
+// Middleware wraps a Handler, running code before and after it.
+// Unlike an HttpFilter, it sees the response written by the
+// handler, and may replace the ResponseWriter given to it.
+//
+// The global middleware and filters, registered with Use and UseFilter,
+// run before the middleware of the route, which wrap its filters, run
+// before its handler:
+//
+//	global middleware -> global filters -> route middleware -> filters -> context filters -> handler
+type Middleware func(Handler) Handler
+
+// a global filter, that routes may skip by name
+type namedFilter struct {
+	name   string
+	filter HttpFilter
+}
+
+// Use register middleware wrapping every request, the first one
+// being the outermost. Unlike the middleware of the routes, they
+// also wrap the requests matching no route, served by the file
+// server, redirected or answered by the router itself.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) Use(middleware ...Middleware) {
+	for _, mw := range middleware {
+		if mw == nil {
+			panic("middleware cannot be nil")
+		}
+	}
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// UseFilter register a filter run for every request, like the global
+// middleware, in registration order. The routes listing its name in
+// their SkipGlobal field do not run it.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) UseFilter(name string, filter HttpFilter) {
+	if filter == nil {
+		panic("filter cannot be nil")
+	}
+	for _, f := range r.filters {
+		if f.name == name {
+			panic("a global filter is already registered with the name " + name)
+		}
+	}
+	r.filters = append(r.filters, namedFilter{name: name, filter: filter})
+}
+
+// wrap the Handler of a request with the global filters,
+// except the skipped ones, then with the global middleware
+func (r *DynamicRouter) wrap(h Handler, skip []string) Handler {
+	if len(r.filters) > 0 {
+		handler := h
+		h = func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+			for _, f := range r.filters {
+				if !skipped(f.name, skip) && !f.filter(w, req) {
+					return
+				}
+			}
+			handler(ctx, w, req)
+		}
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	return h
+}
+
+func skipped(name string, skip []string) bool {
+	for _, s := range skip {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// the handler of the route, wrapped by its context filters,
+// its filters, then its middleware
+func (rt Route) chain() Handler {
+	h := rt.Handler
+	if len(rt.ContextFilters) > 0 {
+		filters, handler := rt.ContextFilters, h
+		h = func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+			for _, filter := range filters {
+				var ok bool
+				if ctx, ok = filter(ctx, w, req); !ok {
+					return
+				}
+			}
+			handler(ctx, w, req)
+		}
+	}
+	if len(rt.Filters) > 0 {
+		filters, handler := rt.Filters, h
+		h = func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+			// we pass all filter in the right order. if one return false
+			// we return, assuming that everything has been written in response
+			for _, filter := range filters {
+				if !filter(w, req) {
+					return
+				}
+			}
+			handler(ctx, w, req)
+		}
+	}
+	for i := len(rt.Middleware) - 1; i >= 0; i-- {
+		h = rt.Middleware[i](h)
+	}
+	return h
+}
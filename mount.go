@@ -0,0 +1,70 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// name of the wildcard catching the path below a mount point.
+// It is removed from the params of the request, so it never
+// hides a param of the prefix.
+const mountedPath = "mountedPath"
+
+// Mount register an existing http.Handler, for instance a
+// net/http/pprof mux or another DynamicRouter, on every path
+// below prefix, for every http method.
+//
+// When stripPrefix is true, the path matched by prefix is removed
+// from the request given to the handler, `/debug/pprof/heap` being
+// served as `/heap` for the prefix `/debug/pprof`.
+//
+// The mounted handler goes through the given filters and is
+// protected against panics like any other route. The path
+// parameters of the prefix are available in the request context.
+func (r *DynamicRouter) Mount(prefix string, handler http.Handler, stripPrefix bool, filters ...HttpFilter) {
+	r.mustRegister("", mountRoute(prefix, handler, stripPrefix, filters))
+}
+
+// Mount register an existing http.Handler on every path below
+// the prefix of the group joined with the given one.
+func (g *Group) Mount(prefix string, handler http.Handler, stripPrefix bool, filters ...HttpFilter) {
+	g.router.mustRegister(g.host, g.route(mountRoute(prefix, handler, stripPrefix, filters)))
+}
+
+// the route serving handler below prefix
+func mountRoute(prefix string, handler http.Handler, stripPrefix bool, filters []HttpFilter) Route {
+	if handler == nil {
+		panic("handler cannot be nil")
+	}
+	return Route{Pattern: prefix + "/*" + mountedPath, Handler: mountHandler(handler, stripPrefix), Filters: filters, mount: true}
+}
+
+// key used to store the path below the mount point in the handler context
+type mountedKey struct{}
+
+// h serving the requests below a mount point, p being the path below it
+func withMountedPath(h Handler, p param) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		h(context.WithValue(ctx, mountedKey{}, p), w, req)
+	}
+}
+
+func mountHandler(handler http.Handler, stripPrefix bool) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		mounted := req.WithContext(ctx)
+		if stripPrefix {
+			u := new(url.URL)
+			*u = *req.URL
+			p, _ := ctx.Value(mountedKey{}).(param)
+			u.Path = "/" + p.value
+			u.RawPath = ""
+			if p.raw != "" && p.raw != p.value {
+				// keep the escaped slashes of the remaining path
+				u.RawPath = "/" + p.raw
+			}
+			mounted.URL = u
+		}
+		handler.ServeHTTP(w, mounted)
+	}
+}
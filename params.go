@@ -0,0 +1,91 @@
+package route
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// a dynamic segment of the path captured
+// while matching a route
+type param struct {
+	key   string
+	value string
+	// the value as escaped in the request path,
+	// when it differs from the decoded one
+	raw string
+}
+
+type params []param
+
+func (ps params) get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.key == key {
+			return p.value, true
+		}
+	}
+	return "", false
+}
+
+// the value of key as escaped in the request path
+func (ps params) raw(key string) string {
+	for _, p := range ps {
+		if p.key == key {
+			if p.raw != "" {
+				return p.raw
+			}
+			return p.value
+		}
+	}
+	return ""
+}
+
+// decode the values captured from the escaped path of a request.
+// Only the values holding escapes are decoded, so nothing is
+// allocated in the common case.
+func (ps params) decode() error {
+	for i, p := range ps {
+		if strings.IndexByte(p.value, '%') < 0 {
+			continue
+		}
+		v, err := url.PathUnescape(p.value)
+		if err != nil {
+			return err
+		}
+		ps[i].raw, ps[i].value = p.value, v
+	}
+	return nil
+}
+
+// key used to store captured params in the handler context
+type paramsKey struct{}
+
+func withParams(ctx context.Context, ps params) context.Context {
+	if len(ps) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, paramsKey{}, ps)
+}
+
+// Param returns the value of the dynamic segment named key
+// for the route being served, or an empty string if the
+// route has no such segment.
+//
+// For a route registered as `/tests/:testId`, the value is
+// retrieved with `route.Param(ctx, "testId")`.
+func Param(ctx context.Context, key string) string {
+	ps, _ := ctx.Value(paramsKey{}).(params)
+	v, _ := ps.get(key)
+	return v
+}
+
+// Params returns all the dynamic segments captured
+// for the route being served, indexed by name.
+func Params(ctx context.Context) map[string]string {
+	ps, _ := ctx.Value(paramsKey{}).(params)
+	m := make(map[string]string, len(ps))
+	for _, p := range ps {
+		m[p.key] = p.value
+	}
+	return m
+}
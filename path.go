@@ -0,0 +1,132 @@
+package route
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// PathPolicy tells how the router handles the requests whose
+// path is not canonical, with empty, `.` or `..` segments,
+// like `//tests///1` or `/tests/./1`.
+type PathPolicy uint8
+
+const (
+	// RedirectCleanPath redirects the requests to their clean path
+	// when it matches a route, with 301 for GET and HEAD requests and
+	// 308 for the other methods, so that they are replayed as is.
+	// It is the default policy.
+	RedirectCleanPath PathPolicy = iota
+	// CleanPath matches the clean path of the requests, without redirecting them
+	CleanPath
+	// StrictPath matches the path of the requests as is
+	StrictPath
+)
+
+// TrailingSlashPolicy tells how the router handles a request
+// whose path ends, or not, with a slash, unlike the pattern of
+// the route it matches. A wildcard route always ignores it.
+type TrailingSlashPolicy uint8
+
+const (
+	// IgnoreTrailingSlash matches `/tests/1` and `/tests/1/` the
+	// same way, whatever the pattern. It is the default policy.
+	IgnoreTrailingSlash TrailingSlashPolicy = iota
+	// StrictTrailingSlash only matches a path ending with a slash
+	// with a pattern ending with a slash, and conversely
+	StrictTrailingSlash
+	// RedirectTrailingSlash redirects the requests to the path
+	// ending, or not, with a slash like the pattern of the route
+	RedirectTrailingSlash
+)
+
+// SetPathPolicy change the handling of the non canonical paths.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) SetPathPolicy(policy PathPolicy) {
+	r.pathPolicy = policy
+}
+
+// SetTrailingSlashPolicy change the handling of the trailing slashes.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) SetTrailingSlashPolicy(policy TrailingSlashPolicy) {
+	r.slashPolicy = policy
+}
+
+// the escaped path of req to match, according to the path policy,
+// and whether the request should be redirected to it when it matches.
+// An error is returned when the path holds an invalid escape.
+func (r *DynamicRouter) requestPath(req *http.Request) (string, bool, error) {
+	p, err := escapedPath(req.URL)
+	if err != nil || r.pathPolicy == StrictPath || p == "" || p[0] != '/' {
+		return p, false, err
+	}
+	c := cleanPath(p)
+	return c, c != p && r.pathPolicy == RedirectCleanPath, nil
+}
+
+// the path of u, escaped like the static parts of the patterns.
+// Escaped slashes are kept, so that they are not taken as
+// separators, and every segment is escaped the same way.
+func escapedPath(u *url.URL) (string, error) {
+	if u.RawPath == "" {
+		return u.EscapedPath(), nil
+	}
+	// RawPath is also set when the path holds characters, like `'`
+	// or `[`, that are valid unescaped but escaped by the patterns
+	parts := strings.Split(u.RawPath, "/")
+	for i, part := range parts {
+		decoded, err := url.PathUnescape(part)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = strings.Replace(escapePath(decoded), "/", "%2F", -1)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// check the trailing slash of p against the pattern of e,
+// according to the trailing slash policy. When they do not
+// fit, the path to redirect the request to is returned,
+// empty if the request should not be served.
+func (r *DynamicRouter) checkTrailingSlash(n *node, e *endpoint, p string) (string, bool) {
+	if r.slashPolicy == IgnoreTrailingSlash || n.kind == wildcardNode || p == "/" {
+		return "", true
+	}
+	slash := strings.HasSuffix(p, "/")
+	if slash == e.slash {
+		return "", true
+	} else if r.slashPolicy == StrictTrailingSlash {
+		return "", false
+	} else if slash {
+		return p[:len(p)-1], false
+	}
+	return p + "/", false
+}
+
+// redirect req to another escaped path, keeping its query
+func redirect(w http.ResponseWriter, req *http.Request, p string) {
+	code := http.StatusPermanentRedirect
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	if req.URL.RawQuery != "" {
+		p += "?" + req.URL.RawQuery
+	}
+	http.Redirect(w, req, p, code)
+}
+
+// the canonical form of p, which is a rooted path. Empty, `.` and `..`
+// segments are removed, but a trailing slash is kept. Does not allocate
+// when p is already clean.
+func cleanPath(p string) string {
+	c := path.Clean(p)
+	if c == "/" || p[len(p)-1] != '/' {
+		return c
+	} else if len(p) == len(c)+1 && p[:len(c)] == c {
+		return p
+	}
+	return c + "/"
+}
@@ -0,0 +1,125 @@
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ErrorHandler is an alternative Handler returning an error. A
+// returned error is rendered by the ErrorRenderer of the router,
+// the handler should not have written anything in that case.
+type ErrorHandler func(context.Context, http.ResponseWriter, *http.Request) error
+
+// HTTPError is implemented by the errors that carry the response
+// to render, errors wrapping one being rendered the same way.
+type HTTPError interface {
+	error
+	// Status is the http status of the response
+	Status() int
+	// Code identifies the error for the clients, may be empty
+	Code() string
+}
+
+// ErrorRenderer writes the response of an error returned by an ErrorHandler
+type ErrorRenderer func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error)
+
+// NewHTTPError create an HTTPError with the given status,
+// code and message, for instance
+// `route.NewHTTPError(http.StatusNotFound, "test_not_found", "no test with this id")`
+func NewHTTPError(status int, code, message string) HTTPError {
+	return &httpError{status: status, code: code, message: message}
+}
+
+type httpError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func (e *httpError) Status() int {
+	return e.status
+}
+
+func (e *httpError) Code() string {
+	return e.code
+}
+
+// SetErrorRenderer replace the ErrorRenderer of the router,
+// RenderProblem by default.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) SetErrorRenderer(renderer ErrorRenderer) {
+	r.errorRenderer = renderer
+}
+
+// WrapErrorHandler transform an ErrorHandler into a Handler, whose
+// errors are rendered by the ErrorRenderer of the router. It allows
+// to use an ErrorHandler in a Route.
+func (r *DynamicRouter) WrapErrorHandler(handler ErrorHandler) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		if err := handler(ctx, w, req); err != nil {
+			r.renderError(ctx, w, req, err)
+		}
+	}
+}
+
+// HandleFuncE register a new ErrorHandler for a given pattern and every http method
+func (r *DynamicRouter) HandleFuncE(pattern string, handler ErrorHandler, filters ...HttpFilter) {
+	r.HandleFunc(pattern, r.WrapErrorHandler(handler), filters...)
+}
+
+// HandleE register a new ErrorHandler for a given http method and pattern
+func (r *DynamicRouter) HandleE(method, pattern string, handler ErrorHandler, filters ...HttpFilter) {
+	r.Handle(method, pattern, r.WrapErrorHandler(handler), filters...)
+}
+
+// HandleFuncE register a new ErrorHandler for a given pattern and every http method
+func (g *Group) HandleFuncE(pattern string, handler ErrorHandler, filters ...HttpFilter) {
+	g.HandleFunc(pattern, g.router.WrapErrorHandler(handler), filters...)
+}
+
+// HandleE register a new ErrorHandler for a given http method and pattern
+func (g *Group) HandleE(method, pattern string, handler ErrorHandler, filters ...HttpFilter) {
+	g.Handle(method, pattern, g.router.WrapErrorHandler(handler), filters...)
+}
+
+func (r *DynamicRouter) renderError(ctx context.Context, w http.ResponseWriter, req *http.Request, err error) {
+	if r.errorRenderer != nil {
+		r.errorRenderer(ctx, w, req, err)
+	} else {
+		RenderProblem(ctx, w, req, err)
+	}
+}
+
+// problem details of an error, as defined by RFC 7807
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// RenderProblem is the default ErrorRenderer. It writes the error
+// as an RFC 7807 `application/problem+json` document.
+//
+// The status, code and message of an HTTPError are rendered. Any
+// other error is rendered as a 500 Internal Server Error, without
+// its message, that could leak internal details.
+func RenderProblem(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	p := problem{Type: "about:blank", Status: http.StatusInternalServerError}
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
+		p.Status, p.Code, p.Detail = httpErr.Status(), httpErr.Code(), httpErr.Error()
+	}
+	p.Title = http.StatusText(p.Status)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,235 @@
+package route
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// DefaultBufferLimit is the size of the response body
+// buffered by default before it is streamed to the client.
+const DefaultBufferLimit = 1 << 20
+
+// SetBufferLimit change the size of the response body held in memory
+// until the handler returns. Past this size, the status and the body
+// are sent to the client, and the rest of the response is streamed.
+// A negative limit buffers the whole response, whatever its size.
+//
+// Once something has been sent, a panicking handler can no longer
+// get a 500 response, the connection is aborted instead.
+//
+// Must be called before the router starts serving requests.
+func (r *DynamicRouter) SetBufferLimit(limit int) {
+	r.bufferLimit = limit
+}
+
+// ResponseStatus is implemented by the ResponseWriter given to the global
+// middleware, to report what the handler responded, for instance to log it.
+// It is also given to the handlers, unless a middleware replaces it.
+type ResponseStatus interface {
+	// Status is the status of the response, 200 if not set
+	Status() int
+	// Written is the number of bytes of body written
+	Written() int64
+}
+
+// will wrap the response writer in order
+// to controle when the status code will be set in ResponseWriter.
+// this is necessary to force 500 status when application
+// code do panic, till only one call to WriteHeader is possible.
+//
+// this is an internal mechanism that should stay hidden
+// and must not interfere with application behavior
+type responseWrapper struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+	// bytes of body written by the handler
+	written int64
+	// size of the body buffered before streaming, no limit if negative
+	limit int
+	// whether the body must be dropped
+	head bool
+	// whether the response is written straight to the client,
+	// and whether its status has been sent
+	streaming, sent bool
+	// buffer of the params of the request, allocated with the
+	// wrapper, enough for most of the routes
+	params [4]param
+}
+
+func (w *responseWrapper) WriteHeader(code int) {
+	w.status = code
+	if w.streaming {
+		w.send()
+	}
+}
+
+func (w *responseWrapper) Write(body []byte) (int, error) {
+	w.written += int64(len(body))
+	if !w.streaming && w.limit >= 0 && len(w.body)+len(body) > w.limit {
+		// too large to be held in memory
+		w.stream()
+	}
+	if w.streaming {
+		w.send()
+		if w.head {
+			return len(body), nil
+		}
+		return w.ResponseWriter.Write(body)
+	}
+	// body may be reused by the caller, it is copied
+	w.body = append(w.body, body...)
+	return len(body), nil
+}
+
+// write the response straight to the client from now,
+// for the responses that should not be held in memory
+func (w *responseWrapper) stream() {
+	w.streaming = true
+}
+
+// forget the status, headers and body
+// set so far, nothing having been sent
+func (w *responseWrapper) reset() {
+	h := w.Header()
+	for k := range h {
+		delete(h, k)
+	}
+	w.status, w.body, w.written = http.StatusOK, w.body[:0], 0
+}
+
+// send the status and what has been buffered, once
+func (w *responseWrapper) send() {
+	if w.sent {
+		return
+	}
+	w.sent = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if !w.head && len(w.body) > 0 {
+		w.ResponseWriter.Write(w.body)
+	}
+	w.body = nil
+}
+
+// send the status and the buffered body to the client.
+// The rest of the response is streamed.
+func (w *responseWrapper) Flush() {
+	w.stream()
+	w.send()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWrapper) Status() int {
+	return w.status
+}
+
+func (w *responseWrapper) Written() int64 {
+	return w.written
+}
+
+// Unwrap returns the underlying ResponseWriter,
+// used by http.ResponseController
+func (w *responseWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// the ResponseWriter given to the handlers. Besides http.Flusher, it only
+// implements the optional interfaces implemented by the underlying writer,
+// so that a handler can rely on a type assertion.
+func (w *responseWrapper) writer() http.ResponseWriter {
+	_, hj := w.ResponseWriter.(http.Hijacker)
+	_, ps := w.ResponseWriter.(http.Pusher)
+	_, rf := w.ResponseWriter.(io.ReaderFrom)
+	switch {
+	case hj && ps && rf:
+		return struct {
+			*responseWrapper
+			hijacker
+			pusher
+			readerFrom
+		}{w, hijacker{w}, pusher{w}, readerFrom{w}}
+	case hj && ps:
+		return struct {
+			*responseWrapper
+			hijacker
+			pusher
+		}{w, hijacker{w}, pusher{w}}
+	case hj && rf:
+		return struct {
+			*responseWrapper
+			hijacker
+			readerFrom
+		}{w, hijacker{w}, readerFrom{w}}
+	case ps && rf:
+		return struct {
+			*responseWrapper
+			pusher
+			readerFrom
+		}{w, pusher{w}, readerFrom{w}}
+	case hj:
+		return struct {
+			*responseWrapper
+			hijacker
+		}{w, hijacker{w}}
+	case ps:
+		return struct {
+			*responseWrapper
+			pusher
+		}{w, pusher{w}}
+	case rf:
+		return struct {
+			*responseWrapper
+			readerFrom
+		}{w, readerFrom{w}}
+	}
+	return w
+}
+
+type hijacker struct{ w *responseWrapper }
+
+// the connection is taken over by the handler,
+// nothing must be sent by the router anymore
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := h.w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		h.w.sent = true
+	}
+	return conn, rw, err
+}
+
+type pusher struct{ w *responseWrapper }
+
+func (p pusher) Push(target string, opts *http.PushOptions) error {
+	return p.w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+type readerFrom struct{ w *responseWrapper }
+
+// a streamed body is handed to the underlying writer, which
+// may send a file without copying it, otherwise it is written
+// like any other body
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	w := r.w
+	if !w.streaming || w.head {
+		// hide ReadFrom from io.Copy, it would call it back
+		return io.Copy(struct{ io.Writer }{w}, src)
+	}
+	w.send()
+	n, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	w.written += n
+	return n, err
+}
+
+// send the response once the handler returned
+func (w *responseWrapper) flush() {
+	if w.head && !w.sent && len(w.body) > 0 && w.Header().Get("Content-Length") == "" {
+		// advertise the length of the dropped body
+		w.Header().Set("Content-Length", strconv.Itoa(len(w.body)))
+	}
+	w.send()
+}
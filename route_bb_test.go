@@ -4,13 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
-	"github.com/squarescale/route"
+	"github.com/jeromedoucet/route"
 )
 
 func TestHijack(t *testing.T) {
@@ -113,6 +118,2390 @@ func TestDynamicRoutePanic(t *testing.T) {
 	}
 }
 
+func TestDynamicRouteMethods(t *testing.T) {
+	// given
+	get := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("get"))
+	}
+	del := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", get)
+	router.Delete("/tests/:testId", del)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	getResp, getErr := http.Get(fmt.Sprintf("%s/tests/1", s.URL))
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/tests/1", s.URL), nil)
+	delResp, delErr := http.DefaultClient.Do(req)
+
+	// then
+	if getErr != nil {
+		t.Fatalf("Expect to have no error, but got %s", getErr.Error())
+	}
+	if delErr != nil {
+		t.Fatalf("Expect to have no error, but got %s", delErr.Error())
+	}
+
+	if getResp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", getResp.StatusCode)
+	}
+	defer getResp.Body.Close()
+	payloadResp, _ := ioutil.ReadAll(getResp.Body)
+	if string(payloadResp) != "get" {
+		t.Fatalf("expect get, but got %s", string(payloadResp))
+	}
+
+	if delResp.StatusCode != 204 {
+		t.Fatalf("Expect 204 return code.Got %d", delResp.StatusCode)
+	}
+}
+
+func TestDynamicRouteMethodNotAllowed(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", handler)
+	router.Handle("put", "/tests/:testId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Post(fmt.Sprintf("%s/tests/1", s.URL), "text/plain", nil)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 405 {
+		t.Fatalf("Expect 405 return code.Got %d", resp.StatusCode)
+	}
+
+	if allow := resp.Header.Get("Allow"); allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf("Expect Allow header to be 'GET, HEAD, OPTIONS, PUT'.Got '%s'", allow)
+	}
+}
+
+func TestDynamicRouteAnyMethodFallback(t *testing.T) {
+	// given
+	get := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	fallback := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", get)
+	router.HandleFunc("/tests/:testId", fallback)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Post(fmt.Sprintf("%s/tests/1", s.URL), "text/plain", nil)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 202 {
+		t.Fatalf("Expect 202 return code.Got %d", resp.StatusCode)
+	}
+}
+
+func TestDynamicRouteParams(t *testing.T) {
+	// given
+	var testID string
+	var all map[string]string
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		testID = route.Param(ctx, "testId")
+		all = route.Params(ctx)
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests/:testId/runs/:runId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	resp, err := http.Get(fmt.Sprintf("%s/tests/42/runs/7", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+
+	if testID != "42" {
+		t.Fatalf("Expect testId to be 42.Got %s", testID)
+	}
+
+	if len(all) != 2 || all["testId"] != "42" || all["runId"] != "7" {
+		t.Fatalf("Expect params to be testId=42 and runId=7.Got %v", all)
+	}
+}
+
+func TestStaticRouteHasNoParams(t *testing.T) {
+	// given
+	var all map[string]string
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		all = route.Params(ctx)
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	resp, err := http.Get(fmt.Sprintf("%s/tests", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+
+	if all == nil || len(all) != 0 {
+		t.Fatalf("Expect an empty params map.Got %v", all)
+	}
+}
+
+func TestWildcardRoutePriority(t *testing.T) {
+	// given
+	named := func(name string) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(name + ":" + route.Param(ctx, "filepath") + route.Param(ctx, "name")))
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/files/latest", named("static"))
+	router.HandleFunc("/files/:name", named("param"))
+	router.HandleFunc("/files/*filepath", named("wildcard"))
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	cases := map[string]string{
+		"/files/latest":       "static:",
+		"/files/report.pdf":   "param:report.pdf",
+		"/files/a/b/c.txt":    "wildcard:a/b/c.txt",
+		"/files/latest/c.txt": "wildcard:latest/c.txt",
+	}
+
+	for p, expected := range cases {
+		// when
+		resp, err := http.Get(fmt.Sprintf("%s%s", s.URL, p))
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expect 200 return code on %s.Got %d", p, resp.StatusCode)
+		}
+
+		payloadResp, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(payloadResp) != expected {
+			t.Fatalf("expect %s on %s, but got %s", expected, p, string(payloadResp))
+		}
+	}
+}
+
+func TestConstrainedDynamicRoutes(t *testing.T) {
+	// given
+	named := func(name string) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(name))
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/items/:id<int>", named("id"))
+	router.HandleFunc("/items/:uid<uuid>", named("uid"))
+	router.HandleFunc("/items/:code{[A-Z]{3}}", named("code"))
+	router.HandleFunc("/items/:slug", named("slug"))
+	router.HandleFunc("/orders/:id<int>", named("order"))
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	cases := map[string]int{
+		"/items/42": 200,
+		"/items/123e4567-e89b-12d3-a456-426614174000": 200,
+		"/items/EUR":       200,
+		"/items/some-item": 200,
+		"/orders/42":       200,
+		"/orders/latest":   404,
+	}
+	bodies := map[string]string{
+		"/items/42": "id",
+		"/items/123e4567-e89b-12d3-a456-426614174000": "uid",
+		"/items/EUR":       "code",
+		"/items/some-item": "slug",
+		"/orders/42":       "order",
+	}
+
+	for p, expected := range cases {
+		// when
+		resp, err := http.Get(fmt.Sprintf("%s%s", s.URL, p))
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != expected {
+			t.Fatalf("Expect %d return code on %s.Got %d", expected, p, resp.StatusCode)
+		}
+
+		payloadResp, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(payloadResp) != bodies[p] {
+			t.Fatalf("expect %s on %s, but got %s", bodies[p], p, string(payloadResp))
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	// given
+	var calls []string
+	filter := func(name string) route.HttpFilter {
+		return func(w http.ResponseWriter, r *http.Request) bool {
+			calls = append(calls, name)
+			return true
+		}
+	}
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler:"+route.Param(ctx, "userId"))
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	api := router.Group("/api/v1", filter("api"))
+	admin := api.Group("admin", filter("admin"))
+	admin.Get("/users/:userId", handler, filter("route"))
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/admin/users/12", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+
+	expected := "api,admin,route,handler:12"
+	if strings.Join(calls, ",") != expected {
+		t.Fatalf("Expect calls to be %s.Got %s", expected, strings.Join(calls, ","))
+	}
+}
+
+func TestGroupFilter(t *testing.T) {
+	// given
+	var called bool
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}
+	filter := func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	router := route.NewDynamicRouter()
+	router.Group("/admin", filter).HandleFunc("/tests/:testId", handler)
+	router.HandleFunc("/tests/:testId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	adminResp, adminErr := http.Get(fmt.Sprintf("%s/admin/tests/1", s.URL))
+
+	// then
+	if adminErr != nil {
+		t.Fatalf("Expect to have no error, but got %s", adminErr.Error())
+	}
+
+	if adminResp.StatusCode != 401 || called {
+		t.Fatalf("Expect 401 return code without calling the handler.Got %d", adminResp.StatusCode)
+	}
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tests/1", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 || !called {
+		t.Fatalf("Expect routes outside of the group not to be filtered.Got %d", resp.StatusCode)
+	}
+}
+
+func TestMount(t *testing.T) {
+	// given
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("metrics of " + route.Param(r.Context(), "tenant")))
+	})
+	router := route.NewDynamicRouter()
+	router.Mount("/tenants/:tenant/internal", mux, true)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tenants/acme/internal/metrics", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+
+	defer resp.Body.Close()
+	payloadResp, _ := ioutil.ReadAll(resp.Body)
+	if string(payloadResp) != "metrics of acme" {
+		t.Fatalf("expect metrics of acme, but got %s", string(payloadResp))
+	}
+}
+
+func TestMountFileServerDirectory(t *testing.T) {
+	// given
+	dir, err := ioutil.TempDir("", "route")
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "file.txt"), []byte("content"), 0644)
+	router := route.NewDynamicRouter()
+	router.Mount("/static", http.FileServer(http.Dir(dir)), true)
+	s := httptest.NewServer(router)
+	defer s.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	cases := []struct {
+		path     string
+		expected int
+		location string
+		body     string
+	}{
+		{"/static/sub/", 200, "", "file.txt"},
+		{"/static/sub", 301, "sub/", ""},
+		{"/static/sub/file.txt", 200, "", "content"},
+	}
+
+	for _, c := range cases {
+		// when
+		resp, err := client.Get(s.URL + c.path)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.expected || resp.Header.Get("Location") != c.location || !strings.Contains(string(body), c.body) {
+			t.Fatalf("Expect %d return code to %s for %s.Got %d to %s and '%s'", c.expected, c.location, c.path, resp.StatusCode, resp.Header.Get("Location"), body)
+		}
+	}
+}
+
+func TestMountHidesMountedPath(t *testing.T) {
+	// given
+	var filterParams, handlerParams map[string]string
+	var path string
+	filter := func(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+		filterParams = route.Params(ctx)
+		return ctx, true
+	}
+	mounted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerParams, path = route.Params(r.Context()), r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	})
+	router := route.NewDynamicRouter()
+	router.Group("/tenants/:mountedPath").WithContextFilters(filter).Mount("/internal", mounted, true)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tenants/acme/internal/metrics", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 || path != "/metrics" {
+		t.Fatalf("Expect /metrics to be served.Got %d and %s", resp.StatusCode, path)
+	}
+
+	expected := map[string]string{"mountedPath": "acme"}
+	if !reflect.DeepEqual(filterParams, expected) || !reflect.DeepEqual(handlerParams, expected) {
+		t.Fatalf("Expect params to be %v.Got %v and %v", expected, filterParams, handlerParams)
+	}
+}
+
+func TestMountWithoutStripping(t *testing.T) {
+	// given
+	sub := route.NewDynamicRouter()
+	sub.Get("/debug/tests/:testId", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(r.URL.Path))
+	})
+	router := route.NewDynamicRouter()
+	router.Mount("/debug", sub, false)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/debug/tests/1", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+
+	defer resp.Body.Close()
+	payloadResp, _ := ioutil.ReadAll(resp.Body)
+	if string(payloadResp) != "/debug/tests/1" {
+		t.Fatalf("expect /debug/tests/1, but got %s", string(payloadResp))
+	}
+}
+
+func TestMountFilterAndPanic(t *testing.T) {
+	// given
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic(errors.New("something really bad"))
+	})
+	filter := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	router := route.NewDynamicRouter()
+	router.Group("/admin").Mount("/panic", panicking, true, filter)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/admin/panic/now", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 401 {
+		t.Fatalf("Expect 401 return code.Got %d", resp.StatusCode)
+	}
+
+	// when
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/admin/panic", s.URL), nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err = http.DefaultClient.Do(req)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 500 {
+		t.Fatalf("Expect 500 return code.Got %d", resp.StatusCode)
+	}
+}
+
+func TestHostRouting(t *testing.T) {
+	// given
+	named := func(name string) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(name + route.Param(ctx, "tenant")))
+		}
+	}
+	app := route.NewDynamicRouter()
+	app.HandleFunc("/tests/:testId", named("app"))
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests/:testId", named("default"))
+	router.Host("api.example.com").HandleFunc("/tests/:testId", named("api"))
+	router.Host(":tenant.example.com").Group("/tests").HandleFunc(":testId", named("tenant:"))
+	router.Host("*.example.org").Mount("/", app, false)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	cases := map[string]string{
+		"api.example.com":      "api",
+		"api.example.com:8080": "api",
+		"acme.example.com":     "tenant:acme",
+		"app.example.org":      "app",
+		"localhost":            "default",
+	}
+
+	for host, expected := range cases {
+		// when
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/tests/1", s.URL), nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expect 200 return code on %s.Got %d", host, resp.StatusCode)
+		}
+
+		payloadResp, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(payloadResp) != expected {
+			t.Fatalf("expect %s on %s, but got %s", expected, host, string(payloadResp))
+		}
+	}
+}
+
+func TestHostRoutingDoesNotFallBackOnDefaultTree(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests/:testId", handler)
+	router.Host("api.example.com").HandleFunc("/other", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/tests/1", s.URL), nil)
+	req.Host = "api.example.com"
+	resp, err := http.DefaultClient.Do(req)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 404 {
+		t.Fatalf("Expect 404 return code.Got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleRoute(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Group("/api").HandleRoute(route.Route{
+		Methods: []string{http.MethodGet, "put"},
+		Pattern: "/tests/:testId",
+		Handler: handler,
+	})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/api/tests/1", s.URL), nil)
+	resp, err := http.DefaultClient.Do(req)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+
+	// when
+	resp, err = http.Post(fmt.Sprintf("%s/api/tests/1", s.URL), "text/plain", nil)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 405 {
+		t.Fatalf("Expect 405 return code.Got %d", resp.StatusCode)
+	}
+
+	if allow := resp.Header.Get("Allow"); allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf("Expect Allow header to be 'GET, HEAD, OPTIONS, PUT'.Got '%s'", allow)
+	}
+}
+
+func TestURL(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Name: "test", Pattern: "/tests/:testId<int>", Handler: handler})
+	router.Group("/api").HandleRoute(route.Route{Name: "file", Pattern: "/files/:owner/*filepath", Handler: handler})
+	router.Host(":tenant.example.com").HandleRoute(route.Route{Name: "home", Pattern: "/", Handler: handler})
+
+	cases := []struct {
+		name     string
+		params   []string
+		expected string
+	}{
+		{"test", []string{"testId", "42"}, "/tests/42"},
+		{"file", []string{"owner", "john doe", "filepath", "a/b?/c.txt"}, "/api/files/john%20doe/a/b%3F/c.txt"},
+		{"file", []string{"owner", "a/b", "filepath", ""}, "/api/files/a%2Fb/"},
+		{"home", nil, "/"},
+	}
+
+	for _, c := range cases {
+		// when
+		u, err := router.URL(c.name, c.params...)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if u != c.expected {
+			t.Fatalf("Expect %s.Got %s", c.expected, u)
+		}
+	}
+}
+
+func TestURLWithTrailingSlash(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.SetTrailingSlashPolicy(route.StrictTrailingSlash)
+	router.HandleRoute(route.Route{Name: "dir", Methods: []string{http.MethodGet}, Pattern: "/dirs/:dirId/", Handler: handler})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	u, err := router.URL("dir", "dirId", "1")
+
+	// then
+	if err != nil || u != "/dirs/1/" {
+		t.Fatalf("Expect /dirs/1/.Got %s (%v)", u, err)
+	}
+
+	if p := router.Routes()[0].Pattern; p != "/dirs/:dirId/" {
+		t.Fatalf("Expect the pattern to keep its trailing slash.Got %s", p)
+	}
+
+	resp, err := http.Get(s.URL + u)
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+}
+
+func TestURLErrors(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Name: "test", Pattern: "/tests/:testId<int>", Handler: handler})
+
+	cases := []struct {
+		name     string
+		params   []string
+		expected error
+	}{
+		{"unknown", nil, route.ErrUnknownRoute},
+		{"test", nil, route.ErrMissingParam},
+		{"test", []string{"other", "42"}, route.ErrMissingParam},
+		{"test", []string{"testId", "abc"}, route.ErrInvalidParam},
+		{"test", []string{"testId"}, route.ErrInvalidParam},
+	}
+
+	for _, c := range cases {
+		// when
+		_, err := router.URL(c.name, c.params...)
+
+		// then
+		if !errors.Is(err, c.expected) {
+			t.Fatalf("Expect %v for %s %v.Got %v", c.expected, c.name, c.params, err)
+		}
+	}
+}
+
+func TestHandleRouteWithDuplicateName(t *testing.T) {
+	// given
+	defer func() {
+		if r := recover(); r != nil {
+			t.Log("successfully caught the router panic")
+		}
+	}()
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	router := route.NewDynamicRouter()
+
+	// when
+	router.HandleRoute(route.Route{Name: "test", Pattern: "/tests/:testId", Handler: handler})
+	router.HandleRoute(route.Route{Name: "test", Pattern: "/other/:testId", Handler: handler})
+
+	// the router must panic. If not => fatal
+	t.Fatal("expect the router to panic")
+}
+
+func TestRoutes(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	filter := func(w http.ResponseWriter, r *http.Request) bool { return true }
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests/:testId", handler)
+	router.Delete("/tests/:testId", handler, filter)
+	router.Group("/api/v1/", filter).HandleRoute(route.Route{
+		Name:    "user",
+		Methods: []string{http.MethodPut, http.MethodGet},
+		Pattern: "users//:userId<int>/",
+		Handler: handler,
+		Filters: []route.HttpFilter{filter},
+		Meta:    map[string]string{"owner": "team-a"},
+	})
+	router.Host("api.example.com").Get("/", handler)
+	router.Mount("/debug", http.NotFoundHandler(), true)
+
+	// when
+	routes := router.Routes()
+
+	// then
+	expected := []route.RouteInfo{
+		{Pattern: "/api/v1/users/:userId<int>/", Methods: []string{"GET", "PUT"}, Filters: 2, Name: "user", Meta: map[string]string{"owner": "team-a"}},
+		{Pattern: "/debug/*mountedPath"},
+		{Pattern: "/tests/:testId"},
+		{Pattern: "/tests/:testId", Methods: []string{"DELETE"}, Filters: 1},
+		{Host: "api.example.com", Pattern: "/", Methods: []string{"GET"}},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("Expect routes to be %+v.Got %+v", expected, routes)
+	}
+}
+
+func TestWalkStopsOnError(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	router := route.NewDynamicRouter()
+	router.Get("/a", handler)
+	router.Get("/b", handler)
+	router.Get("/c", handler)
+	stop := errors.New("stop")
+	var visited []string
+
+	// when
+	err := router.Walk(func(info route.RouteInfo) error {
+		visited = append(visited, info.Pattern)
+		if info.Pattern == "/b" {
+			return stop
+		}
+		return nil
+	})
+
+	// then
+	if err != stop {
+		t.Fatalf("Expect the error of the callback.Got %v", err)
+	}
+
+	if strings.Join(visited, ",") != "/a,/b" {
+		t.Fatalf("Expect /a and /b to be visited.Got %v", visited)
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", handler)
+	router.HandleRoute(route.Route{Name: "file", Pattern: "/files/*filepath", Handler: handler})
+
+	cases := []struct {
+		rt       route.Route
+		expected error
+		conflict string
+	}{
+		{route.Route{Pattern: "/tests/:testId", Handler: nil}, route.ErrInvalidRoute, ""},
+		{route.Route{Pattern: "", Handler: handler}, route.ErrInvalidPattern, ""},
+		{route.Route{Pattern: "/tests/*all/more", Handler: handler}, route.ErrInvalidPattern, ""},
+		{route.Route{Pattern: "/tests/:id<float>", Handler: handler}, route.ErrInvalidPattern, ""},
+		{route.Route{Methods: []string{""}, Pattern: "/other", Handler: handler}, route.ErrInvalidPattern, ""},
+		{route.Route{Methods: []string{"get"}, Pattern: "/tests/:testId/", Handler: handler}, route.ErrDuplicateRoute, "/tests/:testId"},
+		{route.Route{Name: "file", Pattern: "/other", Handler: handler}, route.ErrDuplicateRoute, "/files/*filepath"},
+		{route.Route{Pattern: "/tests/:other/runs", Handler: handler}, route.ErrParamConflict, "/tests/:testId"},
+		{route.Route{Pattern: "/files/*other", Handler: handler}, route.ErrParamConflict, "/files/*filepath"},
+	}
+
+	for _, c := range cases {
+		// when
+		err := router.Register(c.rt)
+
+		// then
+		if !errors.Is(err, c.expected) {
+			t.Fatalf("Expect %v registering %s.Got %v", c.expected, c.rt.Pattern, err)
+		}
+
+		var routeErr *route.RouteError
+		if !errors.As(err, &routeErr) {
+			t.Fatalf("Expect a *RouteError registering %s.Got %T", c.rt.Pattern, err)
+		} else if routeErr.Pattern != c.rt.Pattern || routeErr.Conflict != c.conflict {
+			t.Fatalf("Expect %s to conflict with '%s'.Got %+v", c.rt.Pattern, c.conflict, routeErr)
+		}
+	}
+
+	if len(router.Routes()) != 2 {
+		t.Fatalf("Expect no route to be registered.Got %+v", router.Routes())
+	}
+}
+
+func TestRegisterFailureLeavesNothingRegistered(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	dupErr := router.Register(route.Route{Methods: []string{http.MethodPost, http.MethodGet}, Pattern: "/tests/:testId", Handler: handler})
+	conflictErr := router.Group("/tests").TryHandleFunc("/:other/runs/new", handler)
+	hostErr := router.Host("api.example.com").Register(route.Route{Pattern: "/*", Handler: handler})
+
+	// then
+	if dupErr == nil || conflictErr == nil || hostErr == nil {
+		t.Fatalf("Expect registrations to fail.Got %v, %v and %v", dupErr, conflictErr, hostErr)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("%s/tests/1", s.URL), "text/plain", nil)
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 405 {
+		t.Fatalf("Expect 405 return code.Got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("%s/tests/1/runs/new", s.URL))
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 404 {
+		t.Fatalf("Expect 404 return code.Got %d", resp.StatusCode)
+	}
+
+	if routes := router.Routes(); len(routes) != 1 {
+		t.Fatalf("Expect only one route to be registered.Got %+v", routes)
+	}
+}
+
+func TestRemoveRoute(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Name: "test", Methods: []string{http.MethodGet, http.MethodPost}, Pattern: "/tests/:testId", Handler: handler})
+	router.Get("/tests/:testId/runs", handler)
+	router.Host("api.example.com").HandleFunc("/tests", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	postErr := router.Remove("post", "/tests/:testId")
+	runsErr := router.Group("/tests").Remove(http.MethodGet, "/:testId/runs")
+	hostErr := router.Host("api.example.com").Remove("", "/tests")
+
+	// then
+	if postErr != nil || runsErr != nil || hostErr != nil {
+		t.Fatalf("Expect routes to be removed.Got %v, %v and %v", postErr, runsErr, hostErr)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("%s/tests/1", s.URL), "text/plain", nil)
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 405 {
+		t.Fatalf("Expect 405 return code.Got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("%s/tests/1", s.URL))
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("%s/tests/1/runs", s.URL))
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 404 {
+		t.Fatalf("Expect 404 return code.Got %d", resp.StatusCode)
+	}
+
+	expected := []route.RouteInfo{
+		{Pattern: "/tests/:testId", Methods: []string{http.MethodGet}, Name: "test"},
+	}
+	if routes := router.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("Expect %+v.Got %+v", expected, routes)
+	}
+
+	if u, err := router.URL("test", "testId", "1"); err != nil || u != "/tests/1" {
+		t.Fatalf("Expect the route to keep its name.Got %s and %v", u, err)
+	}
+}
+
+func TestRemoveUnknownRoute(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Name: "test", Methods: []string{http.MethodGet}, Pattern: "/tests/:testId", Handler: handler})
+
+	cases := []struct {
+		method  string
+		pattern string
+	}{
+		{http.MethodPost, "/tests/:testId"},
+		{"", "/tests/:testId"},
+		{http.MethodGet, "/tests/:other"},
+		{http.MethodGet, "/tests"},
+	}
+
+	for _, c := range cases {
+		// when
+		err := router.Remove(c.method, c.pattern)
+
+		// then
+		if !errors.Is(err, route.ErrUnknownRoute) {
+			t.Fatalf("Expect %v removing %s %s.Got %v", route.ErrUnknownRoute, c.method, c.pattern, err)
+		}
+	}
+
+	if err := router.Remove(http.MethodGet, "/tests/:testId"); err != nil {
+		t.Fatalf("Expect the route to be removed.Got %v", err)
+	}
+
+	if _, err := router.URL("test", "testId", "1"); !errors.Is(err, route.ErrUnknownRoute) {
+		t.Fatalf("Expect the name of the route to be removed.Got %v", err)
+	}
+
+	if err := router.Register(route.Route{Name: "test", Pattern: "/tests/:other", Handler: handler}); err != nil {
+		t.Fatalf("Expect the route to be registered again.Got %v", err)
+	}
+}
+
+func TestReplaceRoute(t *testing.T) {
+	// given
+	handler := func(code int) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Name: "test", Methods: []string{http.MethodGet, http.MethodPost}, Pattern: "/tests/:testId", Handler: handler(200)})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	err := router.Replace(route.Route{Methods: []string{http.MethodGet}, Pattern: "/tests/:testId", Handler: handler(202)})
+	groupErr := router.Group("/runs").Replace(route.Route{Methods: []string{http.MethodGet}, Pattern: "/:runId", Handler: handler(201)})
+
+	// then
+	if err != nil || groupErr != nil {
+		t.Fatalf("Expect routes to be replaced.Got %v and %v", err, groupErr)
+	}
+
+	cases := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{http.MethodGet, "/tests/1", 202},
+		{http.MethodPost, "/tests/1", 200},
+		{http.MethodGet, "/runs/1", 201},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, s.URL+c.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != c.expected {
+			t.Fatalf("Expect %d return code for %s %s.Got %d", c.expected, c.method, c.path, resp.StatusCode)
+		}
+	}
+
+	if err := router.Replace(route.Route{Pattern: "/tests/:other", Handler: handler(200)}); !errors.Is(err, route.ErrParamConflict) {
+		t.Fatalf("Expect %v.Got %v", route.ErrParamConflict, err)
+	}
+}
+
+func TestReplaceRouteKeepsNames(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Name: "test", Methods: []string{http.MethodGet, http.MethodPost}, Pattern: "/tests/:testId", Handler: handler})
+	router.HandleRoute(route.Route{Name: "x", Pattern: "/a", Handler: handler})
+
+	// when the named route keeps some of its methods
+	err := router.Replace(route.Route{Name: "test", Methods: []string{http.MethodGet}, Pattern: "/tests/:testId", Handler: handler})
+
+	// then
+	if !errors.Is(err, route.ErrDuplicateRoute) {
+		t.Fatalf("Expect %v.Got %v", route.ErrDuplicateRoute, err)
+	}
+
+	// when the route is replaced on another host
+	err = router.Host("api.example.com").Replace(route.Route{Name: "x", Pattern: "/a", Handler: handler})
+
+	// then
+	if !errors.Is(err, route.ErrDuplicateRoute) {
+		t.Fatalf("Expect %v.Got %v", route.ErrDuplicateRoute, err)
+	}
+
+	// when the named route is partially replaced, then removed
+	if err := router.Replace(route.Route{Methods: []string{http.MethodGet}, Pattern: "/tests/:testId", Handler: handler}); err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+	if err := router.Remove(http.MethodGet, "/tests/:testId"); err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	// then
+	if u, err := router.URL("test", "testId", "1"); err != nil || u != "/tests/1" {
+		t.Fatalf("Expect the name to be kept by the POST route.Got %s (%v)", u, err)
+	}
+
+	var named int
+	for _, info := range router.Routes() {
+		if info.Name == "test" {
+			named++
+		}
+	}
+	if named != 1 {
+		t.Fatalf("Expect a single route named test.Got %d", named)
+	}
+
+	// when
+	if err := router.Remove(http.MethodPost, "/tests/:testId"); err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	// then
+	if _, err := router.URL("test", "testId", "1"); !errors.Is(err, route.ErrUnknownRoute) {
+		t.Fatalf("Expect %v.Got %v", route.ErrUnknownRoute, err)
+	}
+
+	// when the whole named route is replaced
+	if err := router.Replace(route.Route{Name: "x", Pattern: "/a", Handler: handler}); err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	// then
+	if u, err := router.URL("x"); err != nil || u != "/a" {
+		t.Fatalf("Expect /a.Got %s (%v)", u, err)
+	}
+}
+
+func TestReplaceRoutePartialOverlap(t *testing.T) {
+	// given
+	handler := func(code int) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests", handler(200))
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	err := router.Replace(route.Route{Methods: []string{http.MethodGet, http.MethodPut}, Pattern: "/tests", Handler: handler(202)})
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect the route to be replaced.Got %v", err)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		req, _ := http.NewRequest(method, s.URL+"/tests", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != 202 {
+			t.Fatalf("Expect 202 return code for %s.Got %d", method, resp.StatusCode)
+		}
+	}
+}
+
+func TestUpdateRoutesWhileServing(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			pattern := fmt.Sprintf("/tests/:testId/runs/%d", i)
+			router.Get(pattern, handler)
+			router.Host("api.example.com").Get(pattern, handler)
+			if err := router.Remove(http.MethodGet, pattern); err != nil {
+				t.Errorf("Expect the route to be removed.Got %v", err)
+			}
+		}
+	}()
+
+	// when
+	for i := 0; i < 100; i++ {
+		resp, err := http.Get(fmt.Sprintf("%s/tests/%d", s.URL, i))
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+		resp.Body.Close()
+
+		// then
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+		}
+	}
+	<-done
+
+	if routes := router.Routes(); len(routes) != 101 {
+		t.Fatalf("Expect 101 routes to be registered.Got %d", len(routes))
+	}
+}
+
+func TestPathPolicies(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(route.Param(ctx, "testId")))
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	cases := []struct {
+		policy   route.PathPolicy
+		method   string
+		path     string
+		expected int
+		location string
+	}{
+		{route.RedirectCleanPath, http.MethodGet, "//tests///1?q=a", 301, "/tests/1?q=a"},
+		{route.RedirectCleanPath, http.MethodGet, "/tests/./1", 301, "/tests/1"},
+		{route.RedirectCleanPath, http.MethodPost, "/tests/2/../1/", 308, "/tests/1/"},
+		{route.RedirectCleanPath, http.MethodGet, "/tests/1", 200, ""},
+		{route.RedirectCleanPath, http.MethodGet, "//unknown", 404, ""},
+		{route.CleanPath, http.MethodGet, "//tests///1", 200, ""},
+		{route.CleanPath, http.MethodPost, "/tests/./1", 200, ""},
+		{route.StrictPath, http.MethodGet, "//tests///1", 404, ""},
+		{route.StrictPath, http.MethodGet, "/tests/1", 200, ""},
+	}
+
+	for _, c := range cases {
+		router := route.NewDynamicRouter()
+		router.SetPathPolicy(c.policy)
+		router.HandleFunc("/tests/:testId", handler)
+		s := httptest.NewServer(router)
+
+		// when
+		req, _ := http.NewRequest(c.method, s.URL+c.path, nil)
+		resp, err := client.Do(req)
+		s.Close()
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != c.expected {
+			t.Fatalf("Expect %d return code for %s %s.Got %d", c.expected, c.method, c.path, resp.StatusCode)
+		}
+
+		if location := resp.Header.Get("Location"); location != c.location {
+			t.Fatalf("Expect %s to be redirected to '%s'.Got '%s'", c.path, c.location, location)
+		}
+	}
+}
+
+func TestTrailingSlashPolicies(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	cases := []struct {
+		policy   route.TrailingSlashPolicy
+		path     string
+		expected int
+		location string
+	}{
+		{route.IgnoreTrailingSlash, "/tests/1/", 200, ""},
+		{route.IgnoreTrailingSlash, "/runs", 200, ""},
+		{route.StrictTrailingSlash, "/tests/1", 200, ""},
+		{route.StrictTrailingSlash, "/tests/1/", 404, ""},
+		{route.StrictTrailingSlash, "/runs/", 200, ""},
+		{route.StrictTrailingSlash, "/runs", 404, ""},
+		{route.StrictTrailingSlash, "/files/a/", 200, ""},
+		{route.RedirectTrailingSlash, "/tests/1/?q=a", 301, "/tests/1?q=a"},
+		{route.RedirectTrailingSlash, "/runs", 301, "/runs/"},
+		{route.RedirectTrailingSlash, "/runs/", 200, ""},
+		{route.RedirectTrailingSlash, "/", 200, ""},
+	}
+
+	for _, c := range cases {
+		router := route.NewDynamicRouter()
+		router.SetTrailingSlashPolicy(c.policy)
+		router.Get("/", handler)
+		router.Get("/tests/:testId", handler)
+		router.Get("/runs/", handler)
+		router.Get("/files/*filepath", handler)
+		s := httptest.NewServer(router)
+
+		// when
+		resp, err := client.Get(s.URL + c.path)
+		s.Close()
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != c.expected {
+			t.Fatalf("Expect %d return code for %s.Got %d", c.expected, c.path, resp.StatusCode)
+		}
+
+		if location := resp.Header.Get("Location"); location != c.location {
+			t.Fatalf("Expect %s to be redirected to '%s'.Got '%s'", c.path, c.location, location)
+		}
+	}
+}
+
+func TestEscapedPathSegments(t *testing.T) {
+	// given
+	handler := func(name string) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(name + " " + route.Param(ctx, "name")))
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/files/:name", handler("file"))
+	router.Get("/files/:name/meta", handler("meta"))
+	router.Get("/docs/*name", handler("doc"))
+	router.Get("/ids/:name{[a-z ]+}", handler("id"))
+	router.Get("/café", handler("café"))
+	router.Get("/b/it's", handler("quote"))
+	router.Get("/a/[x]", handler("brackets"))
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/files/a%2Fb", "file a/b"},
+		{"/files/a%2fb/meta", "meta a/b"},
+		{"/files/a%20b", "file a b"},
+		{"/files/100%25", "file 100%"},
+		{"/docs/a%2Fb/c", "doc a/b/c"},
+		{"/ids/a%20b", "id a b"},
+		{"/caf%C3%A9", "café "},
+		{"/%63af%c3%a9", "café "},
+		{"/b/it's", "quote "},
+		{"/b/it%27s", "quote "},
+		{"/a/[x]", "brackets "},
+		{"/a/%5Bx%5D", "brackets "},
+		{"/files/it's!", "file it's!"},
+		{"/files/it's%2Fa", "file it's/a"},
+	}
+
+	for _, c := range cases {
+		// when
+		resp, err := http.Get(s.URL + c.path)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expect 200 return code for %s.Got %d", c.path, resp.StatusCode)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != c.expected {
+			t.Fatalf("Expect %s to be served with '%s'.Got '%s'", c.path, c.expected, body)
+		}
+	}
+}
+
+func TestInvalidEscapeIsRejected(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/files/:name", handler)
+	req := httptest.NewRequest(http.MethodGet, "/files/a", nil)
+	req.URL.Path, req.URL.RawPath = "/files/a%zz", "/files/a%zz"
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 400 {
+		t.Fatalf("Expect 400 return code.Got %d", w.Code)
+	}
+}
+
+func TestMountKeepsEscapedPath(t *testing.T) {
+	// given
+	mounted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + r.URL.EscapedPath()))
+	})
+	router := route.NewDynamicRouter()
+	router.Mount("/static", mounted, true)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(s.URL + "/static/a%2Fb/c")
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "/a/b/c /a%2Fb/c" {
+		t.Fatalf("Expect the escaped slash to be kept.Got '%s'", body)
+	}
+}
+
+func TestHeadFallsBackOnGet(t *testing.T) {
+	// given
+	var method string
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.Header().Set("X-Test", "test")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("response"))
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/health", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Head(fmt.Sprintf("%s/health", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expect 200 return code.Got %d", resp.StatusCode)
+	}
+
+	if method != http.MethodHead {
+		t.Fatalf("Expect the GET handler to serve HEAD.Got %s", method)
+	}
+
+	if resp.Header.Get("X-Test") != "test" || resp.ContentLength != int64(len("response")) {
+		t.Fatalf("Expect the headers of the GET response.Got %v", resp.Header)
+	}
+
+	// the recorder does not drop the body like net/http does
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/health", nil))
+	if w.Body.Len() != 0 {
+		t.Fatalf("Expect the body to be dropped.Got %s", w.Body.String())
+	}
+}
+
+func TestHeadAndOptionsCanBeOverridden(t *testing.T) {
+	// given
+	handler := func(code int) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests", handler(200))
+	router.Head("/tests", handler(202))
+	router.Options("/tests", handler(200))
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	for method, expected := range map[string]int{http.MethodHead: 202, http.MethodOptions: 200} {
+		// when
+		req, _ := http.NewRequest(method, s.URL+"/tests", nil)
+		resp, err := http.DefaultClient.Do(req)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != expected {
+			t.Fatalf("Expect %d return code for %s.Got %d", expected, method, resp.StatusCode)
+		}
+
+		if allow := resp.Header.Get("Allow"); allow != "" {
+			t.Fatalf("Expect no Allow header for %s.Got '%s'", method, allow)
+		}
+	}
+}
+
+func TestOptionsListsAllowedMethods(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", handler)
+	router.Delete("/tests/:testId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	req, _ := http.NewRequest(http.MethodOptions, s.URL+"/tests/1", nil)
+	resp, err := http.DefaultClient.Do(req)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 204 {
+		t.Fatalf("Expect 204 return code.Got %d", resp.StatusCode)
+	}
+
+	if allow := resp.Header.Get("Allow"); allow != "DELETE, GET, HEAD, OPTIONS" {
+		t.Fatalf("Expect Allow header to be 'DELETE, GET, HEAD, OPTIONS'.Got '%s'", allow)
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", handler)
+	router.SetNotFoundHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/unknown", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 404 {
+		t.Fatalf("Expect 404 return code.Got %d", resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != `{"error":"not found"}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Expect the not found handler to write the response.Got %s", body)
+	}
+}
+
+func TestMethodNotAllowedHandler(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", handler)
+	router.SetMethodNotAllowedHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(route.Param(ctx, "testId") + " " + w.Header().Get("Allow")))
+	})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Post(fmt.Sprintf("%s/tests/1", s.URL), "text/plain", nil)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 405 {
+		t.Fatalf("Expect 405 return code.Got %d", resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "1 GET, HEAD, OPTIONS" {
+		t.Fatalf("Expect the method not allowed handler to write the response.Got %s", body)
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}
+	var recovered interface{}
+	var stack []byte
+	router := route.NewDynamicRouter()
+	router.Get("/tests/:testId", handler)
+	router.SetPanicHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, rec interface{}, st []byte) {
+		recovered, stack = rec, st
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf(`{"error":"%v","test":"%s"}`, rec, route.Param(ctx, "testId"))))
+	})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tests/1", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 500 {
+		t.Fatalf("Expect 500 return code.Got %d", resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != `{"error":"boom","test":"1"}` {
+		t.Fatalf("Expect the panic handler to write the whole response.Got %s", body)
+	}
+
+	if recovered != "boom" || !strings.Contains(string(stack), "TestPanicHandler") {
+		t.Fatalf("Expect the panic value and stack.Got %v and %s", recovered, stack)
+	}
+}
+
+func TestPanicDropsHandlerHeaders(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Length", "3")
+		w.Write([]byte("a,b"))
+		panic("boom")
+	}
+	router := route.NewDynamicRouter()
+	router.Get("/tests", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when no panic handler is set
+	resp, err := http.Get(fmt.Sprintf("%s/tests", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != 500 || len(body) != 0 || resp.Header.Get("Content-Type") == "text/csv" {
+		t.Fatalf("Expect an empty 500 response.Got %d, %s and '%s' (%v)", resp.StatusCode, resp.Header.Get("Content-Type"), body, err)
+	}
+
+	// when a panic handler is set
+	router = route.NewDynamicRouter()
+	router.Get("/tests", handler)
+	router.SetPanicHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, rec interface{}, st []byte) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"boom"}`))
+	})
+	s2 := httptest.NewServer(router)
+	defer s2.Close()
+	resp, err = http.Get(fmt.Sprintf("%s/tests", s2.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != 500 || string(body) != `{"error":"boom"}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Expect the response of the panic handler only.Got %d, %s and '%s' (%v)", resp.StatusCode, resp.Header.Get("Content-Type"), body, err)
+	}
+}
+
+func TestErrorHandlerRendersProblem(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		switch route.Param(ctx, "testId") {
+		case "missing":
+			return fmt.Errorf("loading test: %w", route.NewHTTPError(http.StatusNotFound, "test_not_found", "no test with this id"))
+		case "broken":
+			return errors.New("db password is wrong")
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	router := route.NewDynamicRouter()
+	router.HandleE(http.MethodGet, "/tests/:testId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	cases := []struct {
+		path     string
+		expected int
+		body     string
+	}{
+		{"/tests/1", 200, ""},
+		{"/tests/missing", 404, `{"type":"about:blank","title":"Not Found","status":404,"detail":"no test with this id","code":"test_not_found"}` + "\n"},
+		{"/tests/broken", 500, `{"type":"about:blank","title":"Internal Server Error","status":500}` + "\n"},
+	}
+
+	for _, c := range cases {
+		// when
+		resp, err := http.Get(s.URL + c.path)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != c.expected {
+			t.Fatalf("Expect %d return code for %s.Got %d", c.expected, c.path, resp.StatusCode)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != c.body {
+			t.Fatalf("Expect %s to be rendered as %s.Got %s", c.path, c.body, body)
+		}
+
+		if c.body != "" && resp.Header.Get("Content-Type") != "application/problem+json" {
+			t.Fatalf("Expect a problem content type.Got %s", resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestErrorRenderer(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return route.NewHTTPError(http.StatusConflict, "test_locked", "the test is locked")
+	}
+	router := route.NewDynamicRouter()
+	router.SetErrorRenderer(func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+		var httpErr route.HTTPError
+		if errors.As(err, &httpErr) {
+			w.WriteHeader(httpErr.Status())
+			w.Write([]byte(httpErr.Code()))
+		}
+	})
+	router.Group("/tests").HandleFuncE("/:testId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tests/1", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 409 {
+		t.Fatalf("Expect 409 return code.Got %d", resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "test_locked" {
+		t.Fatalf("Expect the error to be rendered by the renderer.Got %s", body)
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	// given
+	var calls []string
+	middleware := func(name string) route.Middleware {
+		return func(next route.Handler) route.Handler {
+			return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+" before")
+				next(ctx, w, r)
+				calls = append(calls, name+" after")
+				w.Header().Add("X-Middleware", name)
+			}
+		}
+	}
+	filter := func(w http.ResponseWriter, r *http.Request) bool {
+		calls = append(calls, "filter")
+		if r.URL.Query().Get("reject") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.Use(middleware("global1"), middleware("global2"))
+	router.HandleRoute(route.Route{
+		Methods:    []string{http.MethodGet},
+		Pattern:    "/tests/:testId",
+		Handler:    handler,
+		Filters:    []route.HttpFilter{filter},
+		Middleware: []route.Middleware{middleware("route")},
+	})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	cases := []struct {
+		query    string
+		expected int
+		calls    []string
+	}{
+		{"", 200, []string{"global1 before", "global2 before", "route before", "filter", "handler", "route after", "global2 after", "global1 after"}},
+		{"?reject=1", 401, []string{"global1 before", "global2 before", "route before", "filter", "route after", "global2 after", "global1 after"}},
+	}
+
+	for _, c := range cases {
+		calls = nil
+
+		// when
+		resp, err := http.Get(s.URL + "/tests/1" + c.query)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != c.expected {
+			t.Fatalf("Expect %d return code.Got %d", c.expected, resp.StatusCode)
+		}
+
+		if !reflect.DeepEqual(calls, c.calls) {
+			t.Fatalf("Expect calls %v.Got %v", c.calls, calls)
+		}
+
+		if h := resp.Header["X-Middleware"]; !reflect.DeepEqual(h, []string{"route", "global2", "global1"}) {
+			t.Fatalf("Expect middleware to set headers after the handler.Got %v", h)
+		}
+	}
+}
+
+func TestMiddlewareWrapsResponseWriter(t *testing.T) {
+	// given
+	var status int
+	recordStatus := func(next route.Handler) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w}
+			next(ctx, rec, r)
+			status = rec.status
+		}
+	}
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Pattern: "/tests", Handler: handler, Middleware: []route.Middleware{recordStatus}})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(s.URL + "/tests")
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 202 || status != 202 {
+		t.Fatalf("Expect 202 return code to be seen by the middleware.Got %d and %d", resp.StatusCode, status)
+	}
+
+	if err := router.Register(route.Route{Pattern: "/other", Handler: handler, Middleware: []route.Middleware{nil}}); !errors.Is(err, route.ErrInvalidRoute) {
+		t.Fatalf("Expect %v.Got %v", route.ErrInvalidRoute, err)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func TestGlobalFiltersAndMiddleware(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	auth := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	tag := func(next route.Handler) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Global", "true")
+			next(ctx, w, r)
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.Use(tag)
+	router.UseFilter("auth", auth)
+	router.Get("/tests/:testId", handler)
+	router.HandleRoute(route.Route{Methods: []string{http.MethodGet}, Pattern: "/health", Handler: handler, SkipGlobal: []string{"auth"}})
+	router.ServeStaticAt("fixtures/", route.Classic)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	cases := []struct {
+		path     string
+		auth     string
+		expected int
+	}{
+		{"/tests/1", "", 401},
+		{"/tests/1", "token", 200},
+		{"/health", "", 200},
+		{"/index.html", "", 401},
+		{"/index.html", "token", 200},
+		{"/unknown", "", 401},
+		{"/unknown", "token", 404},
+	}
+
+	for _, c := range cases {
+		// when
+		req, _ := http.NewRequest(http.MethodGet, s.URL+c.path, nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != c.expected {
+			t.Fatalf("Expect %d return code for %s with '%s'.Got %d", c.expected, c.path, c.auth, resp.StatusCode)
+		}
+
+		if resp.Header.Get("X-Global") != "true" {
+			t.Fatalf("Expect the global middleware to run for %s", c.path)
+		}
+	}
+}
+
+func TestGlobalMiddlewareOnRouterResponses(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	var statuses []int
+	record := func(next route.Handler) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w}
+			next(ctx, rec, r)
+			statuses = append(statuses, rec.status)
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.Use(record)
+	router.Get("/tests/:testId", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// when
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/tests/1"},
+		{http.MethodGet, "/unknown"},
+		{http.MethodPost, "/tests/1"},
+		{http.MethodOptions, "/tests/1"},
+		{http.MethodGet, "//tests/1"},
+	} {
+		r, _ := http.NewRequest(req.method, s.URL+req.path, nil)
+		if _, err := client.Do(r); err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+	}
+
+	// then
+	if expected := []int{200, 404, 405, 204, 301}; !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("Expect the middleware to see %v.Got %v", expected, statuses)
+	}
+}
+
+type principalKey struct{}
+
+type principal struct {
+	name string
+}
+
+func authenticate(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	name := r.Header.Get("X-User")
+	if name == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return ctx, false
+	}
+	return context.WithValue(ctx, principalKey{}, &principal{name: name}), true
+}
+
+func TestContextFilter(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		p := ctx.Value(principalKey{}).(*principal)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(p.name + " " + route.Param(ctx, "testId") + " " + ctx.Value(ctxKey("role")).(string)))
+	}
+	role := func(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+		p := ctx.Value(principalKey{}).(*principal)
+		return context.WithValue(ctx, ctxKey("role"), "role of "+p.name), true
+	}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Pattern: "/tests/:testId", Handler: handler, ContextFilters: []route.ContextFilter{authenticate, role}})
+	router.Group("/api").WithContextFilters(authenticate).HandleRoute(route.Route{Pattern: "/tests/:testId", Handler: handler, ContextFilters: []route.ContextFilter{role}})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	cases := []struct {
+		path     string
+		user     string
+		expected int
+		body     string
+	}{
+		{"/tests/1", "alice", 200, "alice 1 role of alice"},
+		{"/tests/1", "", 401, ""},
+		{"/api/tests/2", "bob", 200, "bob 2 role of bob"},
+		{"/api/tests/2", "", 401, ""},
+	}
+
+	for _, c := range cases {
+		// when
+		req, _ := http.NewRequest(http.MethodGet, s.URL+c.path, nil)
+		if c.user != "" {
+			req.Header.Set("X-User", c.user)
+		}
+		resp, err := http.DefaultClient.Do(req)
+
+		// then
+		if err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+
+		if resp.StatusCode != c.expected {
+			t.Fatalf("Expect %d return code for %s.Got %d", c.expected, c.path, resp.StatusCode)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != c.body {
+			t.Fatalf("Expect '%s' for %s.Got '%s'", c.body, c.path, body)
+		}
+	}
+}
+
+func TestResponseAccumulatesWrites(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		buf := make([]byte, 0, 8)
+		for _, chunk := range []string{"first ", "second ", "third"} {
+			// the buffer is reused between writes
+			buf = append(buf[:0], chunk...)
+			w.Write(buf)
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tests", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 201 {
+		t.Fatalf("Expect 201 return code.Got %d", resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "first second third" {
+		t.Fatalf("Expect every write to be sent.Got '%s'", body)
+	}
+}
+
+func TestBufferLimit(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(strings.Repeat("a", 8)))
+		w.Write([]byte(strings.Repeat("b", 8)))
+		if r.URL.Query().Get("panic") != "" {
+			panic("boom")
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.SetBufferLimit(10)
+	router.SetPanicHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, rec interface{}, st []byte) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	router.HandleFunc("/tests", handler)
+	router.HandleFunc("/small", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("small"))
+		panic("boom")
+	})
+	s := httptest.NewUnstartedServer(router)
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	s.Start()
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tests", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 202 || string(body) != "aaaaaaaabbbbbbbb" {
+		t.Fatalf("Expect the whole response to be streamed.Got %d and '%s'", resp.StatusCode, body)
+	}
+
+	// when nothing has been sent yet
+	resp, err = http.Get(fmt.Sprintf("%s/small", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 500 || len(body) != 0 {
+		t.Fatalf("Expect the panic handler to replace the response.Got %d and '%s'", resp.StatusCode, body)
+	}
+
+	// when the response is partially sent
+	resp, err = http.Get(fmt.Sprintf("%s/tests?panic=1", s.URL))
+
+	// then
+	if err == nil {
+		_, err = ioutil.ReadAll(resp.Body)
+	}
+	if err == nil {
+		t.Fatal("Expect the response to be aborted")
+	}
+}
+
+func TestStreamRoute(t *testing.T) {
+	// given
+	release := make(chan struct{})
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte(" second"))
+	}
+	router := route.NewDynamicRouter()
+	router.HandleRoute(route.Route{Pattern: "/stream", Handler: handler, Stream: true})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/stream", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	if resp.StatusCode != 201 {
+		t.Fatalf("Expect 201 return code before the handler returns.Got %d", resp.StatusCode)
+	}
+
+	first := make([]byte, len("first"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "first" {
+		t.Fatalf("Expect the flushed body before the handler returns.Got '%s' and %v", first, err)
+	}
+
+	close(release)
+	rest, _ := ioutil.ReadAll(resp.Body)
+	if string(rest) != " second" {
+		t.Fatalf("Expect the rest of the body.Got '%s'", rest)
+	}
+}
+
+func TestFlushSendsStatus(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(" second"))
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tests", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 202 || string(body) != "first second" {
+		t.Fatalf("Expect the status to be sent on flush.Got %d and '%s'", resp.StatusCode, body)
+	}
+}
+
+func TestResponseStatusReportedToMiddleware(t *testing.T) {
+	// given
+	type report struct {
+		status  int
+		written int64
+	}
+	var reports []report
+	logger := func(next route.Handler) route.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			next(ctx, w, r)
+			rs := w.(route.ResponseStatus)
+			reports = append(reports, report{rs.Status(), rs.Written()})
+		}
+	}
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("0123456789"))
+	}
+	router := route.NewDynamicRouter()
+	router.Use(logger)
+	router.HandleRoute(route.Route{Pattern: "/stream", Handler: handler, Stream: true})
+	router.HandleRoute(route.Route{Pattern: "/buffered", Handler: handler})
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	for _, path := range []string{"/stream", "/buffered", "/unknown"} {
+		if _, err := http.Get(s.URL + path); err != nil {
+			t.Fatalf("Expect to have no error, but got %s", err.Error())
+		}
+	}
+
+	// then
+	if expected := []report{{201, 10}, {201, 10}, {404, 0}}; !reflect.DeepEqual(reports, expected) {
+		t.Fatalf("Expect %v to be reported.Got %v", expected, reports)
+	}
+}
+
+func TestHijackedConnection(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dropped"))
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Expect to have no error, but got %s", err.Error())
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 202 Accepted\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests", handler)
+	var logs strings.Builder
+	s := httptest.NewUnstartedServer(router)
+	s.Config.ErrorLog = log.New(&logs, "", 0)
+	s.Start()
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tests", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 202 || string(body) != "hijacked" {
+		t.Fatalf("Expect the response written on the hijacked connection.Got %d and '%s'", resp.StatusCode, body)
+	}
+
+	s.Close()
+	if logs.Len() != 0 {
+		t.Fatalf("Expect nothing to be written by the router once hijacked.Got '%s'", logs.String())
+	}
+}
+
+func TestNoHijackerOnWriterWithoutIt(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Hijacker); ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if _, ok := w.(http.Pusher); ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests", handler)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tests", nil))
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("Expect the writer to only implement what the underlying one does.Got %d", w.Code)
+	}
+}
+
+type ctxKey string
+
+func TestHandlerContextFromRequest(t *testing.T) {
+	// given
+	var value interface{}
+	var ctxErr error
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		value = ctx.Value(ctxKey("requestId"))
+		ctxErr = ctx.Err()
+		w.WriteHeader(http.StatusOK)
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests/:testId", handler)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey("requestId"), "abc"))
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/tests/1", nil).WithContext(ctx)
+
+	// when
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// then
+	if value != "abc" {
+		t.Fatalf("Expect the request context value to be abc.Got %v", value)
+	}
+
+	if ctxErr != context.Canceled {
+		t.Fatalf("Expect the handler context to be canceled.Got %v", ctxErr)
+	}
+}
+
+func TestHandlerBaseContext(t *testing.T) {
+	// given
+	var db, requestID interface{}
+	var ctxErr error
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		db = ctx.Value(ctxKey("db"))
+		requestID = ctx.Value(ctxKey("requestId"))
+		ctxErr = ctx.Err()
+		w.WriteHeader(http.StatusOK)
+	}
+	base, cancelBase := context.WithCancel(context.WithValue(context.Background(), ctxKey("db"), "pool"))
+	cancelBase()
+	router := route.NewDynamicRouter()
+	router.SetBaseContext(base)
+	router.HandleFunc("/tests/:testId", handler)
+
+	ctx := context.WithValue(context.Background(), ctxKey("requestId"), "abc")
+	req := httptest.NewRequest(http.MethodGet, "/tests/1", nil).WithContext(ctx)
+
+	// when
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// then
+	if db != "pool" {
+		t.Fatalf("Expect the base context value to be pool.Got %v", db)
+	}
+
+	if requestID != "abc" {
+		t.Fatalf("Expect the request context value to be abc.Got %v", requestID)
+	}
+
+	if ctxErr != nil {
+		t.Fatalf("Expect the base context cancellation not to be propagated.Got %v", ctxErr)
+	}
+}
+
 func TestServeStaticClassique(t *testing.T) {
 	// given
 	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,54 @@
+//go:build go1.21
+// +build go1.21
+
+package route_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jeromedoucet/route"
+)
+
+// http.ResponseController requires go 1.20, and EnableFullDuplex go 1.21
+
+func TestResponseController(t *testing.T) {
+	// given
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := rc.EnableFullDuplex(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("response"))
+		if err := rc.Flush(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+	router := route.NewDynamicRouter()
+	router.HandleFunc("/tests", handler)
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	// when
+	resp, err := http.Get(fmt.Sprintf("%s/tests", s.URL))
+
+	// then
+	if err != nil {
+		t.Fatalf("Expect to have no error, but got %s", err.Error())
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != "response" {
+		t.Fatalf("Expect the http.ResponseController to reach the server writer.Got %d and '%s'", resp.StatusCode, body)
+	}
+}
@@ -1,10 +1,15 @@
 package route
 
 import (
+	"bufio"
 	"context"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -14,39 +19,26 @@ func TestRegisterHandlerWithStaticRoute(t *testing.T) {
 	f := func(context.Context, http.ResponseWriter, *http.Request) {
 		called = true
 	}
-	path := []string{"api", "v1", "team"}
+	path := "/api/v1/team"
 
 	r := NewDynamicRouter()
 
 	// when
-	r.registerHandler(path, f)
+	r.registerHandler("", anyMethod, path, f)
 
 	// then
-	if len(r.root) != 1 {
+	if len(r.table().root.statics) != 1 || len(r.table().root.dynamics) != 0 || r.table().root.wildcard != nil {
 		t.Fatal("router must only have one path root")
 	}
 
-	api, apiPresent := r.root["api"]
-	if !apiPresent {
-		t.Fatal("the first node should be on api")
-	} else if len(api.children) != 1 {
-		t.Fatal("the root node must have one children")
-	}
-
-	v1, v1Present := api.children["v1"]
-	if !v1Present {
-		t.Fatal("the second node should be on v1")
-	} else if len(v1.children) != 1 {
-		t.Fatal("the second node must have one children")
-	}
-	team, teamPresent := v1.children["team"]
-	if !teamPresent {
-		t.Fatal("the last node should be on team")
-	} else if len(team.children) != 0 {
+	team := r.table().root.statics[0]
+	if team.path != "/api/v1/team" {
+		t.Fatalf("the static path should be compressed in one node, got %s", team.path)
+	} else if len(team.statics) != 0 {
 		t.Fatal("the last node must have no children")
 	}
 
-	team.handler(context.Background(), httptest.NewRecorder(), &http.Request{})
+	team.endpoints[anyMethod].handler(context.Background(), httptest.NewRecorder(), &http.Request{})
 	if !called {
 		t.Fatal("the handler has not been correctly registered")
 	}
@@ -58,39 +50,26 @@ func TestRegisterHandlerWithEmptyPartOfPath(t *testing.T) {
 	f := func(context.Context, http.ResponseWriter, *http.Request) {
 		called = true
 	}
-	path := []string{"api", "v1", "", "team"}
+	path := "/api/v1//team"
 
 	r := NewDynamicRouter()
 
 	// when
-	r.registerHandler(path, f)
+	r.registerHandler("", anyMethod, path, f)
 
 	// then
-	if len(r.root) != 1 {
+	if len(r.table().root.statics) != 1 {
 		t.Fatal("router must only have one path root")
 	}
 
-	api, apiPresent := r.root["api"]
-	if !apiPresent {
-		t.Fatal("the first node should be on api")
-	} else if len(api.children) != 1 {
-		t.Fatal("the root node must have one children")
-	}
-
-	v1, v1Present := api.children["v1"]
-	if !v1Present {
-		t.Fatal("the second node should be on v1")
-	} else if len(v1.children) != 1 {
-		t.Fatal("the second node must have one children")
-	}
-	team, teamPresent := v1.children["team"]
-	if !teamPresent {
-		t.Fatal("the last node should be on team")
-	} else if len(team.children) != 0 {
+	team := r.table().root.statics[0]
+	if team.path != "/api/v1/team" {
+		t.Fatalf("empty parts of the path should be ignored, got %s", team.path)
+	} else if len(team.statics) != 0 {
 		t.Fatal("the last node must have no children")
 	}
 
-	team.handler(context.Background(), httptest.NewRecorder(), &http.Request{})
+	team.endpoints[anyMethod].handler(context.Background(), httptest.NewRecorder(), &http.Request{})
 	if !called {
 		t.Fatal("the handler has not been correctly registered")
 	}
@@ -106,11 +85,11 @@ func TestRegisterHandlerWithEmptyPath(t *testing.T) {
 	f := func(context.Context, http.ResponseWriter, *http.Request) {}
 
 	// at the same tree level, dymanic path value has to be considered as the same resource
-	path := []string{}
+	path := ""
 	r := NewDynamicRouter()
 
 	// when
-	r.registerHandler(path, f)
+	r.registerHandler("", anyMethod, path, f)
 
 	// the router must panic. If not => fatal
 	t.Fatal("expect the router to panic")
@@ -124,11 +103,11 @@ func TestRegisterHandlerWithNilHandler(t *testing.T) {
 		}
 	}()
 	// at the same tree level, dymanic path value has to be considered as the same resource
-	path := []string{"api", "v1", "item1"}
+	path := "/api/v1/item1"
 	r := NewDynamicRouter()
 
 	// when
-	r.registerHandler(path, nil)
+	r.registerHandler("", anyMethod, path, nil)
 
 	// the router must panic. If not => fatal
 	t.Fatal("expect the router to panic")
@@ -148,53 +127,58 @@ func TestRegisterHandlerWithDynamicPartOfPath(t *testing.T) {
 		called2 = true
 	}
 	// at the same tree level, dymanic path value has to be considered as the same resource
-	path1 := []string{"api", ":someId1", "item1"}
-	path2 := []string{"api", ":someId1", "item2"}
+	path1 := "/api/:someId1/item1"
+	path2 := "/api/:someId1/item2"
 	r := NewDynamicRouter()
 
 	// when
-	r.registerHandler(path1, f1)
-	r.registerHandler(path2, f2)
+	r.registerHandler("", anyMethod, path1, f1)
+	r.registerHandler("", anyMethod, path2, f2)
 
 	// then
-	if len(r.root) != 1 {
+	if len(r.table().root.statics) != 1 {
 		t.Fatal("router must only have one path root")
 	}
 
-	api, apiPresent := r.root["api"]
-	if !apiPresent {
-		t.Fatal("the first node should be on api")
-	} else if len(api.children) != 1 {
-		t.Fatal("the root node must have one children")
+	api := r.table().root.statics[0]
+	if api.path != "/api/" {
+		t.Fatalf("the first node should be on /api/, got %s", api.path)
+	} else if len(api.statics) != 0 || len(api.dynamics) != 1 {
+		t.Fatal("the root node must have one dynamic children")
+	}
+
+	dynamic := api.dynamics[0]
+	if dynamic.path != ":someId1" || dynamic.name != "someId1" {
+		t.Fatalf("the second node should be on :someId1, got %s", dynamic.path)
+	} else if len(dynamic.statics) != 1 || dynamic.statics[0].path != "/item" {
+		t.Fatal("the second node must have one /item children")
 	}
 
-	dynamic, dynamicPresent := api.children[":someId1"]
-	if !dynamicPresent {
-		t.Fatal("the second node should be on v1")
-	} else if len(dynamic.children) != 2 {
-		t.Fatal("the second node must have two children")
+	item := dynamic.statics[0]
+	if len(item.statics) != 2 {
+		t.Fatal("the /item node must have two children")
 	}
 
-	item1, item1Present := dynamic.children["item1"]
-	if !item1Present {
-		t.Fatal("the last node should be on team")
-	} else if len(item1.children) != 0 {
+	item1 := item.staticChild('1')
+	if item1 == nil {
+		t.Fatal("the last node should be on 1")
+	} else if len(item1.statics) != 0 {
 		t.Fatal("the last node must have no children")
 	}
 
-	item1.handler(context.Background(), httptest.NewRecorder(), &http.Request{})
+	item1.endpoints[anyMethod].handler(context.Background(), httptest.NewRecorder(), &http.Request{})
 	if !called1 {
 		t.Fatal("the handler has not been correctly registered")
 	}
 
-	item2, item2Present := dynamic.children["item2"]
-	if !item2Present {
-		t.Fatal("the last node should be on team")
-	} else if len(item2.children) != 0 {
+	item2 := item.staticChild('2')
+	if item2 == nil {
+		t.Fatal("the last node should be on 2")
+	} else if len(item2.statics) != 0 {
 		t.Fatal("the last node must have no children")
 	}
 
-	item2.handler(context.Background(), httptest.NewRecorder(), &http.Request{})
+	item2.endpoints[anyMethod].handler(context.Background(), httptest.NewRecorder(), &http.Request{})
 	if !called2 {
 		t.Fatal("the handler has not been correctly registered")
 	}
@@ -211,13 +195,13 @@ func TestRegisterHandlerWithConflictOnStaticPartOfPath(t *testing.T) {
 
 	f2 := func(context.Context, http.ResponseWriter, *http.Request) {}
 	// at the same tree level, dymanic path value has to be considered as the same resource
-	path1 := []string{"api", "v1", "item1"}
-	path2 := []string{"api", "v1", "item1"}
+	path1 := "/api/v1/item1"
+	path2 := "/api/v1/item1"
 	r := NewDynamicRouter()
 
 	// when
-	r.registerHandler(path1, f1)
-	r.registerHandler(path2, f2)
+	r.registerHandler("", anyMethod, path1, f1)
+	r.registerHandler("", anyMethod, path2, f2)
 
 	// the router must panic. If not => fatal
 	t.Fatal("expect the router to panic")
@@ -234,13 +218,143 @@ func TestRegisterHandlerWithConflictOnDynamicPartOfPath(t *testing.T) {
 
 	f2 := func(context.Context, http.ResponseWriter, *http.Request) {}
 	// at the same tree level, dymanic path value has to be considered as the same resource
-	path1 := []string{"api", ":someId1", "item1"}
-	path2 := []string{"api", ":someId2", "item2"}
+	path1 := "/api/:someId1/item1"
+	path2 := "/api/:someId2/item2"
+	r := NewDynamicRouter()
+
+	// when
+	r.registerHandler("", anyMethod, path1, f1)
+	r.registerHandler("", anyMethod, path2, f2)
+
+	// the router must panic. If not => fatal
+	t.Fatal("expect the router to panic")
+}
+
+func TestRegisterHandlerWithSeveralMethods(t *testing.T) {
+	// given
+	var getCalled bool
+	var deleteCalled bool
+	get := func(context.Context, http.ResponseWriter, *http.Request) {
+		getCalled = true
+	}
+	del := func(context.Context, http.ResponseWriter, *http.Request) {
+		deleteCalled = true
+	}
+	path := "/api/:someId"
+	r := NewDynamicRouter()
+
+	// when
+	r.registerHandler("", http.MethodGet, path, get)
+	r.registerHandler("", http.MethodDelete, path, del)
+
+	// then
+	n := r.table().root.statics[0].dynamics[0]
+	if len(n.endpoints) != 2 {
+		t.Fatalf("expect the node to have 2 endpoints, got %d", len(n.endpoints))
+	}
+	n.endpoints[http.MethodGet].handler(context.Background(), httptest.NewRecorder(), &http.Request{})
+	if !getCalled || deleteCalled {
+		t.Fatal("the GET handler has not been correctly registered")
+	}
+	n.endpoints[http.MethodDelete].handler(context.Background(), httptest.NewRecorder(), &http.Request{})
+	if !deleteCalled {
+		t.Fatal("the DELETE handler has not been correctly registered")
+	}
+	e, allowed := n.endpoint(http.MethodPost)
+	if e != nil {
+		t.Fatal("expect no endpoint for POST")
+	} else if strings.Join(allowed, ",") != "DELETE,GET,HEAD,OPTIONS" {
+		t.Fatalf("expect DELETE, GET, HEAD and OPTIONS to be allowed, got %v", allowed)
+	}
+}
+
+func TestRegisterHandlerWithConstrainedDynamicPartOfPath(t *testing.T) {
+	// given
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+
+	// when
+	r.registerHandler("", anyMethod, "/items/:slug", f)
+	r.registerHandler("", anyMethod, "/items/:id<int>", f)
+	r.registerHandler("", anyMethod, "/items/:code{[A-Z]{3}}", f)
+
+	// then
+	items := r.table().root.statics[0]
+	expected := []string{":id<int>", ":code{[A-Z]{3}}", ":slug"}
+	var ids []string
+	for _, d := range items.dynamics {
+		ids = append(ids, d.path)
+	}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expect dynamic identifiers to be ordered as %v, got %v", expected, ids)
+	}
+	code := items.dynamics[1]
+	if code.name != "code" {
+		t.Fatalf("expect the identifier to be named code, got %s", code.name)
+	} else if !code.constraint("ABC") || code.constraint("ABCD") {
+		t.Fatal("expect the constraint to be anchored on the whole segment")
+	}
+}
+
+func TestRegisterHandlerWithInvalidConstraint(t *testing.T) {
+	// given
+	defer func() {
+		if r := recover(); r != nil {
+			t.Log("successfully caught the router panic")
+		}
+	}()
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
 	r := NewDynamicRouter()
 
 	// when
-	r.registerHandler(path1, f1)
-	r.registerHandler(path2, f2)
+	r.registerHandler("", anyMethod, "/items/:id<float>", f)
+
+	// the router must panic. If not => fatal
+	t.Fatal("expect the router to panic")
+}
+
+func TestTypeConstraints(t *testing.T) {
+	cases := []struct {
+		constraint string
+		value      string
+		expected   bool
+	}{
+		{"int", "42", true},
+		{"int", "-42", true},
+		{"int", "4a2", false},
+		{"int", "-", false},
+		{"uint", "42", true},
+		{"uint", "-42", false},
+		{"alpha", "abcXYZ", true},
+		{"alpha", "abc1", false},
+		{"uuid", "123e4567-e89b-12d3-a456-426614174000", true},
+		{"uuid", "123e4567e89b12d3a456426614174000", false},
+		{"uuid", "123e4567-e89b-12d3-a456-42661417400g", false},
+	}
+
+	for _, c := range cases {
+		if typeConstraints[c.constraint](c.value) != c.expected {
+			t.Fatalf("expect %s on %s to be %t", c.constraint, c.value, c.expected)
+		}
+	}
+}
+
+func TestRegisterHandlerWithConflictOnMethod(t *testing.T) {
+	// given
+	defer func() {
+		if r := recover(); r != nil {
+			t.Log("successfully caught the router panic")
+		}
+	}()
+	f1 := func(context.Context, http.ResponseWriter, *http.Request) {}
+
+	f2 := func(context.Context, http.ResponseWriter, *http.Request) {}
+	path := "/api/v1/item1"
+	r := NewDynamicRouter()
+
+	// when
+	r.registerHandler("", http.MethodGet, path, f1)
+	r.registerHandler("", http.MethodGet, path, f2)
 
 	// the router must panic. If not => fatal
 	t.Fatal("expect the router to panic")
@@ -257,19 +371,21 @@ func TestFindEndpointOnStaticRoute(t *testing.T) {
 
 	r := NewDynamicRouter()
 
-	r.root["api"] = &node{children: make(map[string]*node)}
-	r.root["api"].children["v1"] = &node{children: make(map[string]*node)}
-	r.root["api"].children["v1"].children["item"] = &node{children: make(map[string]*node), handler: f}
+	r.routes.Store(&table{root: &node{indices: "/", statics: []*node{
+		{path: "/api/v1/item", endpoints: map[string]*endpoint{anyMethod: {handler: f}}},
+	}}})
 
 	// when
-	n, err := r.findEndpoint(&req)
+	n, ps, err := r.findEndpoint(req.Host, req.URL.Path, nil)
 
 	if err != nil {
 		t.Fatal("expect error to be nil")
-	} else if n.handler == nil {
+	} else if n.endpoints[anyMethod] == nil {
 		t.Fatal("expect to hava a non nil handler")
+	} else if len(ps) != 0 {
+		t.Fatalf("expect no param to be captured, got %v", ps)
 	}
-	n.handler(context.Background(), httptest.NewRecorder(), &req)
+	n.endpoints[anyMethod].handler(context.Background(), httptest.NewRecorder(), &req)
 	if !called {
 		t.Fatal("the handler is not the right one")
 	}
@@ -286,54 +402,584 @@ func TestFindEndpointOnDynamicRoute(t *testing.T) {
 
 	r := NewDynamicRouter()
 
-	r.root["api"] = &node{children: make(map[string]*node)}
-	r.root["api"].children["v1"] = &node{children: make(map[string]*node)}
-	r.root["api"].children["v1"].children["item"] = &node{children: make(map[string]*node)}
-	r.root["api"].children["v1"].children["item"].children[":itemId"] = &node{children: make(map[string]*node), handler: f}
+	r.routes.Store(&table{root: &node{indices: "/", statics: []*node{
+		{path: "/api/v1/item/", dynamics: []*node{
+			{kind: dynamicNode, path: ":itemId", name: "itemId", endpoints: map[string]*endpoint{anyMethod: {handler: f}}},
+		}},
+	}}})
+
+	// when
+	n, ps, err := r.findEndpoint(req.Host, req.URL.Path, nil)
+
+	if err != nil {
+		t.Fatal("expect error to be nil")
+	} else if n.endpoints[anyMethod] == nil {
+		t.Fatal("expect to hava a non nil handler")
+	} else if v, _ := ps.get("itemId"); v != "12345" {
+		t.Fatalf("expect itemId to be 12345, got %s", v)
+	}
+	n.endpoints[anyMethod].handler(context.Background(), httptest.NewRecorder(), &req)
+	if !called {
+		t.Fatal("the handler is not the right one")
+	}
+}
+
+func TestFindEndpointOnWildcardRoute(t *testing.T) {
+	// given
+	var called bool
+	f := func(context.Context, http.ResponseWriter, *http.Request) {
+		called = true
+	}
+
+	req := http.Request{URL: &url.URL{Path: "/api/files/some/deep/file.txt"}}
+
+	r := NewDynamicRouter()
+	r.registerHandler("", anyMethod, "/api/files/*filepath", f)
 
 	// when
-	n, err := r.findEndpoint(&req)
+	n, ps, err := r.findEndpoint(req.Host, req.URL.Path, nil)
 
 	if err != nil {
 		t.Fatal("expect error to be nil")
-	} else if n.handler == nil {
+	} else if n.endpoints[anyMethod] == nil {
 		t.Fatal("expect to hava a non nil handler")
+	} else if v, _ := ps.get("filepath"); v != "some/deep/file.txt" {
+		t.Fatalf("expect filepath to be some/deep/file.txt, got %s", v)
 	}
-	n.handler(context.Background(), httptest.NewRecorder(), &req)
+	n.endpoints[anyMethod].handler(context.Background(), httptest.NewRecorder(), &req)
 	if !called {
 		t.Fatal("the handler is not the right one")
 	}
 }
 
+func TestFindEndpointOnWildcardRouteWithEmptyRemainingPath(t *testing.T) {
+	// given
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+
+	req := http.Request{URL: &url.URL{Path: "/api/files/"}}
+
+	r := NewDynamicRouter()
+	r.registerHandler("", anyMethod, "/api/files/*filepath", f)
+
+	// when
+	n, ps, err := r.findEndpoint(req.Host, req.URL.Path, nil)
+
+	if err != nil {
+		t.Fatal("expect error to be nil")
+	} else if n.endpoints[anyMethod] == nil {
+		t.Fatal("expect to hava a non nil handler")
+	} else if v, ok := ps.get("filepath"); !ok || v != "" {
+		t.Fatalf("expect filepath to be empty, got %s", v)
+	}
+}
+
+func TestFindEndpointBacktracking(t *testing.T) {
+	// given
+	r := NewDynamicRouter()
+	register := func(pattern string) {
+		r.registerHandler("", anyMethod, pattern, func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(pattern))
+		})
+	}
+	matched := func(n *node) string {
+		w := httptest.NewRecorder()
+		n.endpoints[anyMethod].handler(context.Background(), w, &http.Request{})
+		return w.Body.String()
+	}
+	register("/users/new/edit")
+	register("/users/:id/history")
+	register("/users/:id/history/:entry")
+	register("/users/*rest")
+	register("/teams/:id")
+	register("/teams/new/members")
+
+	cases := []struct {
+		path     string
+		expected string
+		params   params
+	}{
+		// the static route is preferred
+		{"/users/new/edit", "/users/new/edit", nil},
+		// static dead-end, fallback on the dynamic sibling
+		{"/users/new/history", "/users/:id/history", params{{key: "id", value: "new"}}},
+		{"/users/new/history/3", "/users/:id/history/:entry", params{{key: "id", value: "new"}, {key: "entry", value: "3"}}},
+		// static and dynamic dead-ends, fallback on the wildcard sibling
+		{"/users/new/other", "/users/*rest", params{{key: "rest", value: "new/other"}}},
+		{"/users/12/history/3/4", "/users/*rest", params{{key: "rest", value: "12/history/3/4"}}},
+		// the static node has no endpoint, fallback on the dynamic sibling
+		{"/teams/new", "/teams/:id", params{{key: "id", value: "new"}}},
+		{"/teams/new/members", "/teams/new/members", nil},
+	}
+
+	for _, c := range cases {
+		// when
+		n, ps, err := r.findEndpoint("", c.path, nil)
+
+		// then
+		if err != nil {
+			t.Fatalf("expect %s to match %s, got error %s", c.path, c.expected, err.Error())
+		} else if matched(n) != c.expected {
+			t.Fatalf("expect %s to match %s, got %s", c.path, c.expected, matched(n))
+		} else if !reflect.DeepEqual(ps, c.params) {
+			t.Fatalf("expect %s to capture %v, got %v", c.path, c.params, ps)
+		}
+	}
+
+	if _, _, err := r.findEndpoint("", "/teams/new/other", nil); err == nil {
+		t.Fatal("expect /teams/new/other not to match")
+	}
+}
+
+func TestRegisterHandlerWithWildcardNotLast(t *testing.T) {
+	// given
+	defer func() {
+		if r := recover(); r != nil {
+			t.Log("successfully caught the router panic")
+		}
+	}()
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	path := "/api/*filepath/item"
+	r := NewDynamicRouter()
+
+	// when
+	r.registerHandler("", anyMethod, path, f)
+
+	// the router must panic. If not => fatal
+	t.Fatal("expect the router to panic")
+}
+
+func TestRegisterHandlerWithConflictOnWildcardPartOfPath(t *testing.T) {
+	// given
+	defer func() {
+		if r := recover(); r != nil {
+			t.Log("successfully caught the router panic")
+		}
+	}()
+	f1 := func(context.Context, http.ResponseWriter, *http.Request) {}
+
+	f2 := func(context.Context, http.ResponseWriter, *http.Request) {}
+	path1 := "/api/*filepath"
+	path2 := "/api/*other"
+	r := NewDynamicRouter()
+
+	// when
+	r.registerHandler("", anyMethod, path1, f1)
+	r.registerHandler("", http.MethodGet, path2, f2)
+
+	// the router must panic. If not => fatal
+	t.Fatal("expect the router to panic")
+}
+
+func TestRegisterHandlerSplitsStaticNodes(t *testing.T) {
+	// given
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+
+	// when
+	r.registerHandler("", anyMethod, "/api/v1/items", f)
+	r.registerHandler("", anyMethod, "/api/v2/items", f)
+	r.registerHandler("", anyMethod, "/api", f)
+
+	// then
+	api := r.table().root.staticChild('/')
+	if api == nil || api.path != "/api" {
+		t.Fatal("the first node should be on /api")
+	} else if api.endpoints[anyMethod] == nil {
+		t.Fatal("the /api node should have a handler")
+	}
+	v := api.staticChild('/')
+	if v == nil || v.path != "/v" || len(v.endpoints) != 0 {
+		t.Fatal("the common prefix /v should be split in its own node")
+	} else if v.indices != "12" {
+		t.Fatalf("the /v node should have 1 and 2 children, got %s", v.indices)
+	}
+	if v1 := v.staticChild('1'); v1.path != "1/items" || v1.endpoints[anyMethod] == nil {
+		t.Fatalf("the last node should be on 1/items, got %s", v1.path)
+	}
+}
+
+func TestUpdateLeavesPublishedTableUntouched(t *testing.T) {
+	// given
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+	r.registerHandler("", anyMethod, "/api/v1/items", f)
+	r.registerHandler("", anyMethod, "/api/v1/items/:itemId", f)
+	before := r.table()
+
+	// when
+	r.registerHandler("", anyMethod, "/api/v2/items", f)
+	r.registerHandler("", anyMethod, "/api/v1/items/:itemId/parts", f)
+
+	// then
+	var ps params
+	if n := before.lookup("", "/api/v2/items", &ps); n != nil {
+		t.Fatal("the published table should not see the new routes")
+	} else if n := before.lookup("", "/api/v1/items/1/parts", &ps); n != nil {
+		t.Fatal("the published table should not see the new routes")
+	} else if n := before.lookup("", "/api/v1/items/1", &ps); n == nil {
+		t.Fatal("the published table should still serve its routes")
+	}
+	if n := r.lookup("", "/api/v2/items", &ps); n == nil {
+		t.Fatal("the new table should serve the new routes")
+	}
+}
+
+func TestRemoveRebuildsCompactTree(t *testing.T) {
+	// given
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+	r.registerHandler("", anyMethod, "/api/v1/items", f)
+	r.registerHandler("", anyMethod, "/api/v2/items", f)
+
+	// when
+	err := r.Remove("", "/api/v2/items")
+
+	// then
+	if err != nil {
+		t.Fatalf("expect the route to be removed, got %v", err)
+	}
+	root := r.table().root
+	if len(root.statics) != 1 || root.statics[0].path != "/api/v1/items" {
+		t.Fatalf("the remaining route should be in a single node, got %s", root.statics[0].path)
+	}
+}
+
+func TestLookupDoesNotAllocate(t *testing.T) {
+	// given
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+	r.registerHandler("", anyMethod, "/api/v1/item", f)
+	r.registerHandler("", anyMethod, "/api/v1/item/:itemId<int>/history/:entry", f)
+	r.registerHandler("", anyMethod, "/api/v1/files/*filepath", f)
+	ps := make(params, 0, 8)
+
+	for _, path := range []string{"/api/v1/item/", "/api/v1/item/12345/history/3", "/api/v1/files/a/b"} {
+		// when
+		allocs := testing.AllocsPerRun(100, func() {
+			ps = ps[:0]
+			if r.lookup("", path, &ps) == nil {
+				t.Fatalf("expect %s to match", path)
+			}
+		})
+
+		// then
+		if allocs != 0 {
+			t.Fatalf("expect no allocation on %s, got %f", path, allocs)
+		}
+	}
+}
+
+func TestHostMatch(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		host     string
+		expected bool
+		params   params
+	}{
+		{"api.example.com", "api.example.com", true, nil},
+		{"api.example.com", "API.Example.com", true, nil},
+		{"api.example.com", "app.example.com", false, nil},
+		{"api.example.com", "v1.api.example.com", false, nil},
+		{"*.example.com", "app.example.com", true, nil},
+		{"*.example.com", "a.b.example.com", true, nil},
+		{"*.example.com", "example.com", false, nil},
+		{"*.example.com", ".example.com", false, nil},
+		{":tenant.example.com", "acme.example.com", true, params{{key: "tenant", value: "acme"}}},
+		{":tenant.example.com", "a.b.example.com", false, nil},
+		{":tenant.:region.example.com", "acme.eu.example.com", true, params{{key: "tenant", value: "acme"}, {key: "region", value: "eu"}}},
+		{":tenant.example.com", "acme.example.org", false, nil},
+	}
+
+	for _, c := range cases {
+		// given
+		h, err := parseHost(c.pattern)
+		if err != nil {
+			t.Fatalf("expect %s to be valid, got %s", c.pattern, err.Error())
+		}
+		var ps params
+
+		// when
+		matched := h.match(c.host, &ps)
+		if len(ps) == 0 {
+			ps = nil
+		}
+
+		// then
+		if matched != c.expected {
+			t.Fatalf("expect %s matching %s to be %t", c.pattern, c.host, c.expected)
+		} else if !reflect.DeepEqual(ps, c.params) {
+			t.Fatalf("expect %s on %s to capture %v, got %v", c.pattern, c.host, c.params, ps)
+		}
+	}
+}
+
+func TestParseHostWithInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"", "api..example.com", "api.*.example.com", "*.:tenant.example.com", ":.example.com"} {
+		if _, err := parseHost(pattern); err == nil {
+			t.Fatalf("expect %s to be invalid", pattern)
+		}
+	}
+}
+
+func TestHostPrecedence(t *testing.T) {
+	// given
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+
+	// when
+	r.registerHandler("*.example.com", anyMethod, "/", f)
+	r.registerHandler(":tenant.example.com", anyMethod, "/", f)
+	r.registerHandler("api.example.com", anyMethod, "/", f)
+	r.registerHandler("*.example.org", anyMethod, "/", f)
+
+	// then
+	var patterns []string
+	for _, h := range r.table().hosts {
+		patterns = append(patterns, h.pattern)
+	}
+	expected := []string{"api.example.com", ":tenant.example.com", "*.example.com", "*.example.org"}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Fatalf("expect hosts to be ordered as %v, got %v", expected, patterns)
+	}
+}
+
 // #######################################################################
 // ################## 		Benchmark 		##################
 // #######################################################################
 
-func BenchmarkFindEndpointOnStaticRoute(b *testing.B) {
+func TestCleanPath(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "/"},
+		{"//", "/"},
+		{"/tests/1", "/tests/1"},
+		{"/tests/1/", "/tests/1/"},
+		{"//tests///1//", "/tests/1/"},
+		{"/tests/./1/.", "/tests/1"},
+		{"/tests/2/../1", "/tests/1"},
+		{"/../tests", "/tests"},
+	}
+
+	for _, c := range cases {
+		// when
+		cleaned := cleanPath(c.path)
+
+		// then
+		if cleaned != c.expected {
+			t.Fatalf("expect %s to be cleaned to %s, got %s", c.path, c.expected, cleaned)
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { cleanPath("/tests/1/") }); allocs != 0 {
+		t.Fatalf("expect no allocation on a clean path, got %f", allocs)
+	}
+}
+
+func TestResponseWrapperStreamsPastLimit(t *testing.T) {
+	// given
+	rec := httptest.NewRecorder()
+	w := &responseWrapper{ResponseWriter: rec, status: 200, limit: 4}
+
+	// when
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("ab"))
+	w.Write([]byte("cd"))
+
+	// then
+	if w.sent || rec.Body.Len() != 0 {
+		t.Fatalf("expect nothing to be sent below the limit, got %s", rec.Body.String())
+	}
+
+	// when
+	w.Write([]byte("ef"))
+	w.flush()
+
+	// then
+	if !w.sent || rec.Code != http.StatusCreated || rec.Body.String() != "abcdef" {
+		t.Fatalf("expect the response to be streamed past the limit, got %d and %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFindEndpointDoesNotAllocate(t *testing.T) {
+	// given
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+	r.registerHandler("", anyMethod, "/api/v1/item/:itemId/part/:partId", f)
+	r.registerHandler("", anyMethod, "/api/v1/files/*filepath", f)
+	w := &responseWrapper{}
+
+	for _, path := range []string{"/api/v1/item/12/part/3", "/api/v1/files/some/deep/file.txt/"} {
+		// when
+		allocs := testing.AllocsPerRun(100, func() { r.findEndpoint("", path, w.params[:0]) })
+
+		// then
+		if allocs != 0 {
+			t.Fatalf("expect no allocation to find %s, got %f", path, allocs)
+		}
+	}
+}
+
+// the lookup of ServeHTTP, the params being
+// captured in a buffer of the response wrapper
+func benchmarkFindEndpoint(b *testing.B, path string, patterns ...string) {
+	b.ReportAllocs()
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+	for _, pattern := range patterns {
+		r.registerHandler("", anyMethod, pattern, f)
+	}
 	b.RunParallel(func(pb *testing.PB) {
-		f := func(context.Context, http.ResponseWriter, *http.Request) {}
-		r := NewDynamicRouter()
-		r.root["api"] = &node{children: make(map[string]*node)}
-		r.root["api"].children["v1"] = &node{children: make(map[string]*node)}
-		r.root["api"].children["v1"].children["item"] = &node{children: make(map[string]*node), handler: f}
-		req := http.Request{URL: &url.URL{Path: "/api/v1/item/"}}
+		w := &responseWrapper{}
 		for pb.Next() {
-			r.findEndpoint(&req)
+			r.findEndpoint("", path, w.params[:0])
 		}
 	})
 }
 
-func BenchmarkFindEndpointOnDynamicRouteRoute(b *testing.B) {
+func BenchmarkFindEndpointOnStaticRoute(b *testing.B) {
+	benchmarkFindEndpoint(b, "/api/v1/item/", "/api/v1/item", "/api/v1/team")
+}
+
+func BenchmarkFindEndpointOnDynamicRoute(b *testing.B) {
+	benchmarkFindEndpoint(b, "/api/v1/item/12345", "/api/v1/item/:itemId", "/api/v1/item/:itemId/history")
+}
+
+func BenchmarkFindEndpointOnWildcardRoute(b *testing.B) {
+	benchmarkFindEndpoint(b, "/api/v1/files/some/deep/file.txt", "/api/v1/files/*filepath")
+}
+
+// the whole cost of a request, the response wrapper
+// and the handler context included
+func BenchmarkServeHTTPOnDynamicRoute(b *testing.B) {
+	b.ReportAllocs()
+	f := func(context.Context, http.ResponseWriter, *http.Request) {}
+	r := NewDynamicRouter()
+	r.Get("/api/v1/item/:itemId", f)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/item/12345", nil)
 	b.RunParallel(func(pb *testing.PB) {
-		f := func(context.Context, http.ResponseWriter, *http.Request) {}
-		r := NewDynamicRouter()
-		r.root["api"] = &node{children: make(map[string]*node)}
-		r.root["api"].children["v1"] = &node{children: make(map[string]*node)}
-		r.root["api"].children["v1"].children["item"] = &node{children: make(map[string]*node)}
-		r.root["api"].children["v1"].children["item"].children[":itemId"] = &node{children: make(map[string]*node), handler: f}
-		req := http.Request{URL: &url.URL{Path: "/api/v1/item/12345"}}
+		w := httptest.NewRecorder()
 		for pb.Next() {
-			r.findEndpoint(&req)
+			r.ServeHTTP(w, req)
 		}
 	})
 }
+
+type fakeHijacker struct{}
+
+func (fakeHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+type fakePusher struct{}
+
+func (fakePusher) Push(string, *http.PushOptions) error {
+	return nil
+}
+
+type fakeReaderFrom struct{ rec *httptest.ResponseRecorder }
+
+func (f fakeReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	return f.rec.Body.ReadFrom(src)
+}
+
+func TestResponseWrapperForwardsOptionalInterfaces(t *testing.T) {
+	rec := httptest.NewRecorder()
+	hj, ps, rf := fakeHijacker{}, fakePusher{}, fakeReaderFrom{rec}
+	cases := []struct {
+		name       string
+		res        http.ResponseWriter
+		hj, ps, rf bool
+	}{
+		{"none", struct{ http.ResponseWriter }{rec}, false, false, false},
+		{"hijacker", struct {
+			http.ResponseWriter
+			http.Hijacker
+		}{rec, hj}, true, false, false},
+		{"pusher", struct {
+			http.ResponseWriter
+			http.Pusher
+		}{rec, ps}, false, true, false},
+		{"reader from", struct {
+			http.ResponseWriter
+			io.ReaderFrom
+		}{rec, rf}, false, false, true},
+		{"hijacker and pusher", struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{rec, hj, ps}, true, true, false},
+		{"hijacker and reader from", struct {
+			http.ResponseWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{rec, hj, rf}, true, false, true},
+		{"pusher and reader from", struct {
+			http.ResponseWriter
+			http.Pusher
+			io.ReaderFrom
+		}{rec, ps, rf}, false, true, true},
+		{"all", struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{rec, hj, ps, rf}, true, true, true},
+	}
+	for _, c := range cases {
+		// given
+		w := &responseWrapper{ResponseWriter: c.res, status: 200, limit: -1}
+
+		// when
+		res := w.writer()
+
+		// then
+		if _, ok := res.(http.Hijacker); ok != c.hj {
+			t.Fatalf("%s: expect http.Hijacker to be %t", c.name, c.hj)
+		}
+		if _, ok := res.(http.Pusher); ok != c.ps {
+			t.Fatalf("%s: expect http.Pusher to be %t", c.name, c.ps)
+		}
+		if _, ok := res.(io.ReaderFrom); ok != c.rf {
+			t.Fatalf("%s: expect io.ReaderFrom to be %t", c.name, c.rf)
+		}
+		if _, ok := res.(http.Flusher); !ok {
+			t.Fatalf("%s: expect http.Flusher to always be implemented", c.name)
+		}
+		if _, ok := res.(ResponseStatus); !ok {
+			t.Fatalf("%s: expect ResponseStatus to always be implemented", c.name)
+		}
+		u, ok := res.(interface{ Unwrap() http.ResponseWriter })
+		if !ok || u.Unwrap() != c.res {
+			t.Fatalf("%s: expect Unwrap to return the underlying writer", c.name)
+		}
+	}
+}
+
+func TestResponseWrapperReadFrom(t *testing.T) {
+	// given
+	rec := httptest.NewRecorder()
+	res := struct {
+		http.ResponseWriter
+		io.ReaderFrom
+	}{rec, fakeReaderFrom{rec}}
+	w := &responseWrapper{ResponseWriter: res, status: 200, limit: -1}
+
+	// when
+	io.Copy(w.writer(), strings.NewReader("buffered"))
+
+	// then
+	if w.sent || rec.Body.Len() != 0 || string(w.body) != "buffered" || w.written != 8 {
+		t.Fatalf("expect the body to be buffered, got %s", rec.Body.String())
+	}
+
+	// when
+	w.Flush()
+	io.Copy(w.writer(), strings.NewReader(" streamed"))
+
+	// then
+	if !w.sent || rec.Body.String() != "buffered streamed" || w.written != 17 {
+		t.Fatalf("expect the body to be streamed, got %s", rec.Body.String())
+	}
+}
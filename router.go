@@ -9,7 +9,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // FileServerMode allow to adapt some behavior of the file server.
@@ -24,12 +27,58 @@ const (
 	Spa FileServerMode = "spa"
 )
 
-// internal representation of a
-// routes path segment
-type node struct {
-	handler  func(context.Context, http.ResponseWriter, *http.Request)
-	filters  []HttpFilter
-	children map[string]*node
+// anyMethod is the endpoint key used by handlers
+// that accept every http method
+const anyMethod = ""
+
+// route registered for one http method of a node
+type endpoint struct {
+	// handler of the route, wrapped by its middleware and filters
+	handler Handler
+	info    RouteInfo
+	// names of the global filters not run for the route
+	skip []string
+	// parsed pattern, to insert the endpoint again
+	segs []segment
+	// whether the pattern ends with a slash
+	slash bool
+	// whether the last param is the path below a mount point
+	mount bool
+}
+
+// find the endpoint of the node that should serve
+// the given method. If none fits but the node do have
+// endpoints, the allowed methods are returned.
+//
+// HEAD requests are served by the GET endpoint when
+// no endpoint is registered for HEAD.
+func (n *node) endpoint(method string) (*endpoint, []string) {
+	if e, ok := n.endpoints[method]; ok {
+		return e, nil
+	} else if e, ok := n.endpoints[http.MethodGet]; ok && method == http.MethodHead {
+		return e, nil
+	} else if e, ok := n.endpoints[anyMethod]; ok {
+		return e, nil
+	}
+	return nil, n.allowed()
+}
+
+// the sorted methods served by the endpoints of n,
+// including the ones answered by the router itself
+func (n *node) allowed() []string {
+	allowed := make([]string, 0, len(n.endpoints)+2)
+	for m := range n.endpoints {
+		allowed = append(allowed, m)
+	}
+	if _, ok := n.endpoints[http.MethodOptions]; !ok {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	_, head := n.endpoints[http.MethodHead]
+	if _, get := n.endpoints[http.MethodGet]; get && !head {
+		allowed = append(allowed, http.MethodHead)
+	}
+	sort.Strings(allowed)
+	return allowed
 }
 
 type customFileServer struct {
@@ -92,9 +141,21 @@ func (fs *customFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 //
 // Implements the http/Handler interface
 type DynamicRouter struct {
-	root       map[string]*node
-	ctx        context.Context
-	fileServer *customFileServer
+	// current *table, replaced as a whole on each update
+	routes      atomic.Value
+	mu          sync.Mutex      // serializes the updates of routes
+	ctx         context.Context // base context, may be nil
+	pathPolicy  PathPolicy
+	slashPolicy TrailingSlashPolicy
+	fileServer  *customFileServer
+	bufferLimit int
+	// hooks, may be nil
+	notFoundHandler         Handler
+	methodNotAllowedHandler Handler
+	panicHandler            PanicHandler
+	errorRenderer           ErrorRenderer
+	middleware              []Middleware  // global middleware
+	filters                 []namedFilter // global filters
 }
 
 // functions that are executed before there corresponding handler.
@@ -105,6 +166,43 @@ type HttpFilter func(http.ResponseWriter, *http.Request) bool
 // function type used by application code
 type Handler func(context.Context, http.ResponseWriter, *http.Request)
 
+// ContextFilter is a filter that may enrich the context given to
+// the handler, for instance with the authenticated user. It returns
+// the context to give to the next context filters and to the handler.
+// When false is returned, the execution is stopped like for an
+// HttpFilter and the filter MUST take care of the response.
+type ContextFilter func(context.Context, http.ResponseWriter, *http.Request) (context.Context, bool)
+
+// Route describes a route registered with HandleRoute,
+// when HandleFunc or Handle are not enough.
+type Route struct {
+	// Name identifies the route when building its URL, optional.
+	Name string
+	// Methods served by the route, every method when empty.
+	Methods []string
+	Pattern string
+	Handler Handler
+	Filters []HttpFilter
+	// ContextFilters run after Filters, before the handler
+	ContextFilters []ContextFilter
+	// Middleware wrapping the filters and the handler of the route,
+	// the first one being the outermost
+	Middleware []Middleware
+	// SkipGlobal lists the names of the global
+	// filters that must not run for the route
+	SkipGlobal []string
+	// Stream sends the response of the route to the client as it is
+	// written, instead of buffering it, for large or long responses.
+	// The status is sent on the first call to WriteHeader or Write, so
+	// a panicking handler can no longer get a 500 response afterward.
+	Stream bool
+	// Meta holds free informations about the route,
+	// reported by Walk and Routes
+	Meta map[string]string
+	// whether the route serves a handler registered with Mount
+	mount bool
+}
+
 // WrapHttpHandleFunc make easier to integrate route with existing
 // code by transforming a standart httpHandleFunc into a route.Handler
 func WrapHttpHandleFunc(f func(w http.ResponseWriter, r *http.Request)) Handler {
@@ -113,150 +211,190 @@ func WrapHttpHandleFunc(f func(w http.ResponseWriter, r *http.Request)) Handler
 	}
 }
 
-// will wrap the response writer in order
-// to controle when the status code will be set in ResponseWriter.
-// this is necessary to force 500 status when application
-// code do panic, till only one call to WriteHeader is possible.
+// NewDynamicRouter create a new DynamicRouter
+func NewDynamicRouter() *DynamicRouter {
+	r := &DynamicRouter{bufferLimit: DefaultBufferLimit}
+	r.routes.Store(newTable())
+	return r
+}
+
+func (r *DynamicRouter) ServeStaticAt(root string, mode FileServerMode) {
+	r.fileServer = &customFileServer{root: http.Dir(root), mode: mode, handler: http.FileServer(http.Dir(root))}
+}
+
+// HandleFunc register a new Handler for a given pattern.
+// The handler will serve every http method, unless a more
+// specific one is registered on the same pattern with Handle.
+func (r *DynamicRouter) HandleFunc(pattern string, handler Handler, filters ...HttpFilter) {
+	r.registerHandler("", anyMethod, pattern, handler, filters...)
+}
+
+// Handle register a new Handler for a given http method and pattern.
+// When the pattern match a request but no handler has been registered
+// for its method, the router responds with 405 Method Not Allowed.
 //
-// this is an internal mechanism that should stay hidden
-// and must not interfere with application behavior
-type responseWrapper struct {
-	http.ResponseWriter
-	http.Hijacker
-	status int
-	body   []byte
+// Unless handlers are registered for them, HEAD requests are served
+// by the GET handler without the body, and OPTIONS requests are
+// answered with the allowed methods.
+func (r *DynamicRouter) Handle(method, pattern string, handler Handler, filters ...HttpFilter) {
+	r.mustRegister("", Route{Methods: []string{method}, Pattern: pattern, Handler: handler, Filters: filters})
 }
 
-func (w *responseWrapper) WriteHeader(code int) {
-	w.status = code
+// HandleRoute register a new Route.
+func (r *DynamicRouter) HandleRoute(rt Route) {
+	r.mustRegister("", rt)
 }
 
-func (w *responseWrapper) Write(body []byte) (int, error) {
-	w.body = body
-	return len(body), nil
+// Register register a new Route, like HandleRoute, but returns
+// a *RouteError instead of panicking when the route is invalid
+// or clashes with a registered one. Nothing is registered when
+// an error is returned.
+func (r *DynamicRouter) Register(rt Route) error {
+	return r.register("", rt)
 }
 
-func (w *responseWrapper) Flush() {
-	if f, ok := w.ResponseWriter.(http.Flusher); ok {
-		w.ResponseWriter.Write(w.body)
-		w.body = nil
-		f.Flush()
-	}
+// TryHandleFunc register a new Handler for a given pattern, like
+// HandleFunc, but returns a *RouteError instead of panicking.
+func (r *DynamicRouter) TryHandleFunc(pattern string, handler Handler, filters ...HttpFilter) error {
+	return r.register("", Route{Pattern: pattern, Handler: handler, Filters: filters})
 }
 
-func (w *responseWrapper) flush() {
-	w.ResponseWriter.WriteHeader(w.status)
-	w.ResponseWriter.Write(w.body)
+// Get register a new Handler for GET requests on a given pattern
+func (r *DynamicRouter) Get(pattern string, handler Handler, filters ...HttpFilter) {
+	r.Handle(http.MethodGet, pattern, handler, filters...)
 }
 
-// NewDynamicRouter create a new DynamicRouter
-func NewDynamicRouter() *DynamicRouter {
-	r := new(DynamicRouter)
-	r.root = make(map[string]*node)
-	r.ctx = context.Background()
-	return r
+// Head register a new Handler for HEAD requests on a given pattern
+func (r *DynamicRouter) Head(pattern string, handler Handler, filters ...HttpFilter) {
+	r.Handle(http.MethodHead, pattern, handler, filters...)
 }
 
-func (r *DynamicRouter) ServeStaticAt(root string, mode FileServerMode) {
-	r.fileServer = &customFileServer{root: http.Dir(root), mode: mode, handler: http.FileServer(http.Dir(root))}
+// Post register a new Handler for POST requests on a given pattern
+func (r *DynamicRouter) Post(pattern string, handler Handler, filters ...HttpFilter) {
+	r.Handle(http.MethodPost, pattern, handler, filters...)
 }
 
-// HandleFunc register a new Handler for a given pattern
-func (r *DynamicRouter) HandleFunc(pattern string, handler Handler, filters ...HttpFilter) {
-	r.registerHandler(SplitPath(pattern), handler, filters...)
+// Put register a new Handler for PUT requests on a given pattern
+func (r *DynamicRouter) Put(pattern string, handler Handler, filters ...HttpFilter) {
+	r.Handle(http.MethodPut, pattern, handler, filters...)
+}
+
+// Patch register a new Handler for PATCH requests on a given pattern
+func (r *DynamicRouter) Patch(pattern string, handler Handler, filters ...HttpFilter) {
+	r.Handle(http.MethodPatch, pattern, handler, filters...)
+}
+
+// Delete register a new Handler for DELETE requests on a given pattern
+func (r *DynamicRouter) Delete(pattern string, handler Handler, filters ...HttpFilter) {
+	r.Handle(http.MethodDelete, pattern, handler, filters...)
+}
+
+// Options register a new Handler for OPTIONS requests on a given pattern
+func (r *DynamicRouter) Options(pattern string, handler Handler, filters ...HttpFilter) {
+	r.Handle(http.MethodOptions, pattern, handler, filters...)
 }
 
 // http/Handler implementation
 func (r *DynamicRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	w := &responseWrapper{ResponseWriter: res, status: 200, body: []byte{}}
-	hj, ok := res.(http.Hijacker)
-	if ok {
-		w.Hijacker = hj
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			// we dunno what's happened so, we set the
-			// status code to 500
-			w.WriteHeader(http.StatusInternalServerError)
-			w.flush()
-		}
-	}()
-	n, err := r.findEndpoint(req)
+	w := &responseWrapper{ResponseWriter: res, status: 200, limit: r.bufferLimit}
+	var ps params
+	defer r.recoverPanic(w, req, &ps)
+	var h Handler
+	var skip []string
+	h, ps, skip = r.route(w, req)
+	r.wrap(h, skip)(r.handlerContext(req, ps), w.writer(), req)
+	w.flush()
+}
+
+// the Handler serving req, without the global filters and middleware,
+// with the params of the matched route and the global filters it skips
+func (r *DynamicRouter) route(w *responseWrapper, req *http.Request) (Handler, params, []string) {
+	p, fix, err := r.requestPath(req)
 	if err != nil {
-		if r.fileServer == nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.flush()
-		} else {
-			r.fileServer.ServeHTTP(res, req)
-		}
-	} else if n.handler != nil {
-		// we pass all filter in the right order. if one return false
-		// we return, assuming that everything has been written in response
-		for _, filter := range n.filters {
-			if !filter(w, req) {
-				w.flush()
-				return
-			}
-		}
-		n.handler(r.ctx, w, req)
-		w.flush()
+		return statusHandler(http.StatusBadRequest), nil, nil
 	}
+	n, ps, err := r.findEndpoint(req.Host, p, w.params[:0])
+	if err != nil || len(n.endpoints) == 0 {
+		return r.notFound(w), nil, nil
+	} else if err := ps.decode(); err != nil {
+		return statusHandler(http.StatusBadRequest), nil, nil
+	}
+	e, allowed := n.endpoint(req.Method)
+	if e == nil && req.Method == http.MethodOptions {
+		// answer OPTIONS requests unless a route does
+		return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			w.WriteHeader(http.StatusNoContent)
+		}, ps, nil
+	} else if e == nil {
+		return r.methodNotAllowed(allowed), ps, nil
+	}
+	// the body written by a handler not registered for HEAD is dropped
+	w.head = req.Method == http.MethodHead && e != n.endpoints[http.MethodHead]
+	if e.info.Stream {
+		w.stream()
+	}
+	if to, ok := r.checkTrailingSlash(n, e, p); !ok && to == "" {
+		return r.notFound(w), nil, nil
+	} else if !ok {
+		p, fix = to, true
+	}
+	if fix {
+		return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+			redirect(w, req, p)
+		}, ps, nil
+	}
+	if e.mount {
+		// the path below the mount point is only given to the
+		// mounted handler, not to the params of the request
+		last := len(ps) - 1
+		return withMountedPath(e.handler, ps[last]), ps[:last], e.skip
+	}
+	return e.handler, ps, e.skip
 }
 
-func (r *DynamicRouter) registerHandler(paths []string, handler Handler, filters ...HttpFilter) {
-	if handler == nil {
-		panic("handler cannot be nil")
-	} else if len(paths) < 1 {
-		panic("path cannot be nil")
+// a Handler responding with an empty body
+func statusHandler(code int) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(code)
 	}
-	children := r.root
-	var n *node
-	var ok bool
-	for _, path := range paths {
-		if path == "" {
-			continue
-		}
-		/*
-		 * we only consider static and dynamic identifier of the path.
-		 *
-		 * For static :
-		 * If at a given non terminal node, the resource
-		 * already exist, and if the identifier is static, we just
-		 * pass to the next level.
-		 *
-		 * For dynamic :
-		 * if the identifier of the resource is dynamic and if a
-		 * dynamic identifier already exist with another name, the router will panic.
-		 *
-		 * Common :
-		 * If the node denoted by the incoming path already has a handler, the router will panic
-		 */
-		if strings.HasPrefix(path, ":") {
-			for m := range children {
-				if strings.HasPrefix(m, ":") && path != m {
-					panic("a dynamic identifier has already been registered at that level")
-				}
-			}
-		}
-		n, ok = children[path]
-		if !ok {
-			n = &node{}
-			n.children = make(map[string]*node)
-			children[path] = n
-		}
-		children = n.children
+}
+
+func (r *DynamicRouter) registerHandler(host, method, pattern string, handler Handler, filters ...HttpFilter) {
+	rt := Route{Pattern: pattern, Handler: handler, Filters: filters}
+	if method != anyMethod {
+		rt.Methods = []string{method}
 	}
-	if n.handler != nil {
-		panic("a handler is already registered for this path")
+	r.mustRegister(host, rt)
+}
+
+func (r *DynamicRouter) mustRegister(host string, rt Route) {
+	if err := r.register(host, rt); err != nil {
+		panic(err.Error())
+	}
+}
+
+// register a route in the tree of the given host pattern.
+// Nothing is registered when an error is returned.
+func (r *DynamicRouter) register(host string, rt Route) error {
+	return r.update(func(t *table) error {
+		return t.register(host, rt, false)
+	})
+}
+
+// find the node matching the escaped path, the params being
+// captured in ps, which does not allocate as long as it is large enough
+func (r *DynamicRouter) findEndpoint(host, path string, ps params) (*node, params, error) {
+	n := r.lookup(host, path, &ps)
+	if n == nil {
+		return nil, nil, errors.New("unknown path")
 	}
-	n.handler = handler
-	n.filters = filters
+	return n, ps, nil
 }
 
-func (r *DynamicRouter) findEndpoint(req *http.Request) (n *node, err error) {
-	// todo clean path
-	// todo check url encoder
-	return parseTree(r.root, SplitPath(req.URL.Path))
+// look for the node matching path in the current table
+func (r *DynamicRouter) lookup(host, path string, ps *params) *node {
+	return r.table().lookup(host, path, ps)
 }
 
 // SplitPath is an utils function that will
@@ -265,25 +403,3 @@ func SplitPath(path string) []string {
 	p := strings.TrimPrefix(path, "/")
 	return strings.Split(strings.TrimSuffix(p, "/"), "/")
 }
-
-func parseTree(children map[string]*node, path []string) (*node, error) {
-	n, ok := children[path[0]]
-	if !ok {
-		// if no static path found, look for a dynamic one
-		// todo make some optimization
-		for p, dn := range children {
-			if strings.HasPrefix(p, ":") {
-				n = dn
-				break
-			}
-		}
-		if n == nil {
-			return n, errors.New("unknown path")
-		}
-
-	}
-	if len(path) > 1 {
-		return parseTree(n.children, path[1:])
-	}
-	return n, nil
-}
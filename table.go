@@ -0,0 +1,342 @@
+package route
+
+import (
+	"sort"
+	"strings"
+)
+
+// the routes served by a DynamicRouter at a given time.
+//
+// A published table is never modified: updates are applied on
+// a copy that replaces it atomically, so requests are served
+// without locks while routes are added or removed. The copy
+// only duplicates the nodes on the way to the updated routes,
+// the other ones being shared between both tables.
+type table struct {
+	root  *node
+	hosts []*hostTree
+	names map[string]*namedRoute
+}
+
+func newTable() *table {
+	return &table{root: newNode(), names: make(map[string]*namedRoute)}
+}
+
+// the table currently served
+func (r *DynamicRouter) table() *table {
+	return r.routes.Load().(*table)
+}
+
+// apply fn on a copy of the current table, published if fn succeeds.
+// Requests being served keep using the table they started with.
+func (r *DynamicRouter) update(fn func(*table) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.table().copy()
+	if err := fn(t); err != nil {
+		return err
+	}
+	r.routes.Store(t)
+	return nil
+}
+
+// a copy of t whose roots may be modified
+func (t *table) copy() *table {
+	c := &table{root: t.root.clone(), hosts: make([]*hostTree, len(t.hosts)), names: make(map[string]*namedRoute, len(t.names))}
+	for i, h := range t.hosts {
+		hc := *h
+		hc.root = h.root.clone()
+		c.hosts[i] = &hc
+	}
+	for name, nr := range t.names {
+		c.names[name] = nr
+	}
+	return c
+}
+
+// register a route in the tree of the given host pattern. When
+// replace is true, the handlers already registered for the methods
+// and pattern of the route are replaced instead of being an error.
+func (t *table) register(host string, rt Route, replace bool) error {
+	fail := func(err error, reason, conflict string) error {
+		return &RouteError{Err: err, Pattern: rt.Pattern, Conflict: conflict, Reason: reason}
+	}
+	if rt.Handler == nil {
+		return fail(ErrInvalidRoute, "handler cannot be nil", "")
+	}
+	for _, mw := range rt.Middleware {
+		if mw == nil {
+			return fail(ErrInvalidRoute, "middleware cannot be nil", "")
+		}
+	}
+	for _, filter := range rt.ContextFilters {
+		if filter == nil {
+			return fail(ErrInvalidRoute, "context filter cannot be nil", "")
+		}
+	}
+	segs, err := parsePattern(rt.Pattern)
+	if err != nil {
+		return fail(ErrInvalidPattern, err.Error(), "")
+	}
+	methods := []string{anyMethod}
+	if len(rt.Methods) > 0 {
+		methods = make([]string, len(rt.Methods))
+		for i, m := range rt.Methods {
+			if m == anyMethod {
+				return fail(ErrInvalidPattern, "method cannot be empty", "")
+			}
+			methods[i] = strings.ToUpper(m)
+		}
+		sort.Strings(methods)
+	}
+	if replace {
+		// only the methods already registered are replaced, the other
+		// ones are added. The name of a route is released once all its
+		// methods are removed, so that the replacing route may take it.
+		if existing := t.registered(host, segs, methods); len(existing) > 0 {
+			t.remove(host, segs, existing)
+		}
+	}
+	last := segs[len(segs)-1]
+	slash := strings.HasSuffix(rt.Pattern, "/") && last.kind != wildcardNode && !strings.HasSuffix(last.value, "/")
+	if nr, ok := t.names[rt.Name]; ok && rt.Name != "" {
+		return fail(ErrDuplicateRoute, "a route is already registered with this name", nr.pattern)
+	}
+	root := t.findHost(host)
+	if root == nil && host != "" {
+		if _, err := parseHost(host); err != nil {
+			return fail(ErrInvalidPattern, err.Error(), "")
+		}
+	}
+	if root != nil {
+		existing, conflict, reason := root.check(segs)
+		if conflict != nil {
+			return fail(ErrParamConflict, reason, conflict.firstPattern())
+		}
+		for _, m := range methods {
+			if e, ok := existing.endpointFor(m); ok {
+				return fail(ErrDuplicateRoute, "a handler is already registered for this path", e.info.Pattern)
+			}
+		}
+	} else {
+		root = t.addHost(host)
+	}
+	n, err := root.insert(segs)
+	if err != nil {
+		return fail(ErrParamConflict, err.Error(), "")
+	}
+	e := &endpoint{handler: rt.chain(), skip: rt.SkipGlobal, segs: segs, slash: slash, mount: rt.mount, info: RouteInfo{
+		Host:       host,
+		Pattern:    patternString(segs, slash),
+		Filters:    len(rt.Filters) + len(rt.ContextFilters),
+		Middleware: len(rt.Middleware),
+		Name:       rt.Name,
+		Stream:     rt.Stream,
+	}}
+	if methods[0] != anyMethod {
+		e.info.Methods = methods
+	}
+	if rt.Meta != nil {
+		e.info.Meta = copyMeta(rt.Meta)
+	}
+	n.setEndpoints(methods, e)
+	if rt.Name != "" {
+		t.names[rt.Name] = &namedRoute{pattern: e.info.Pattern, segs: segs, slash: slash, host: host, endpoint: e}
+	}
+	return nil
+}
+
+// remove the handlers registered for methods on the route
+// denoted by segs. Returns false if one of them does not exist.
+//
+// The tree of the host is rebuilt without them, so that it stays
+// as compact as if they had never been registered.
+func (t *table) remove(host string, segs []segment, methods []string) bool {
+	root := t.findHost(host)
+	if root == nil {
+		return false
+	}
+	n, _, _ := root.check(segs)
+	removed := make(map[string]*endpoint, len(methods))
+	for _, m := range methods {
+		e, ok := n.endpointFor(m)
+		if !ok {
+			return false
+		}
+		removed[m] = e
+	}
+	// the methods kept for each endpoint, in walk order
+	var endpoints []*endpoint
+	kept := make(map[*endpoint][]string)
+	root.walk(func(m string, e *endpoint) {
+		if _, ok := kept[e]; !ok {
+			endpoints = append(endpoints, e)
+			kept[e] = nil
+		}
+		if removed[m] != e {
+			kept[e] = append(kept[e], m)
+		}
+	})
+	rebuilt := newNode()
+	for _, e := range endpoints {
+		methods := kept[e]
+		nr, named := t.names[e.info.Name]
+		named = named && nr.host == host && nr.endpoint == e
+		if len(methods) == 0 {
+			if named {
+				delete(t.names, e.info.Name)
+			}
+			continue
+		} else if e.info.Methods != nil && len(methods) != len(e.info.Methods) {
+			// the route still serves some of its methods
+			c := *e
+			c.info.Methods = methods
+			e = &c
+			if named {
+				// the published table still refers to nr
+				moved := *nr
+				moved.endpoint = e
+				t.names[e.info.Name] = &moved
+			}
+		}
+		n, _ := rebuilt.insert(e.segs)
+		n.setEndpoints(methods, e)
+	}
+	t.setHostRoot(host, rebuilt)
+	return true
+}
+
+// the methods among the given ones having a handler
+// registered on the route denoted by segs
+func (t *table) registered(host string, segs []segment, methods []string) []string {
+	var n *node
+	if root := t.findHost(host); root != nil {
+		n, _, _ = root.check(segs)
+	}
+	var found []string
+	for _, m := range methods {
+		if _, ok := n.endpointFor(m); ok {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// look for the node matching the escaped path, trailing slash excluded, in
+// the tree of the first host pattern matching host, or in the
+// default tree if none does. A wildcard captures the trailing slash.
+func (t *table) lookup(host, path string, ps *params) *node {
+	trimmed := path
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		trimmed = path[:len(path)-1]
+	}
+	n := t.match(host, trimmed, ps)
+	if n != nil && n.kind == wildcardNode && len(trimmed) < len(path) {
+		// the wildcard value ends the trimmed path, it is
+		// extended to the end of path without allocating
+		last := &(*ps)[len(*ps)-1]
+		if last.value != "" {
+			last.value = path[len(trimmed)-len(last.value):]
+		}
+	}
+	return n
+}
+
+func (t *table) match(host, path string, ps *params) *node {
+	if len(t.hosts) > 0 {
+		host = stripPort(host)
+		for _, h := range t.hosts {
+			if h.match(host, ps) {
+				return h.root.match(path, ps)
+			}
+		}
+	}
+	return t.root.match(path, ps)
+}
+
+// returns the tree of the routes registered for a host pattern,
+// nil if there is none yet. The default tree is returned for an
+// empty pattern.
+func (t *table) findHost(pattern string) *node {
+	if pattern == "" {
+		return t.root
+	}
+	for _, h := range t.hosts {
+		if h.pattern == pattern {
+			return h.root
+		}
+	}
+	return nil
+}
+
+// create the tree of the routes of a valid host pattern
+func (t *table) addHost(pattern string) *node {
+	h, err := parseHost(pattern)
+	if err != nil {
+		panic(err.Error())
+	}
+	// keep the hosts sorted by precedence, then registration order
+	i := len(t.hosts)
+	for i > 0 && t.hosts[i-1].precedence() > h.precedence() {
+		i--
+	}
+	t.hosts = append(t.hosts, nil)
+	copy(t.hosts[i+1:], t.hosts[i:])
+	t.hosts[i] = h
+	return h.root
+}
+
+// replace the tree of a host pattern. The tree of
+// a host pattern without any route is dropped.
+func (t *table) setHostRoot(pattern string, root *node) {
+	if pattern == "" {
+		t.root = root
+		return
+	}
+	for i, h := range t.hosts {
+		if h.pattern == pattern {
+			if root.empty() {
+				t.hosts = append(t.hosts[:i], t.hosts[i+1:]...)
+			} else {
+				h.root = root
+			}
+			return
+		}
+	}
+}
+
+// Remove unregister the handler of a http method on a pattern,
+// while the router may be serving requests. An empty method
+// denotes the handler registered for every method, with HandleFunc.
+//
+// A *RouteError wrapping ErrUnknownRoute is returned when no
+// such handler is registered.
+func (r *DynamicRouter) Remove(method, pattern string) error {
+	return r.remove("", method, pattern)
+}
+
+// Replace register a new Route, replacing the handlers registered
+// for the same methods and pattern, if any, while the router may
+// be serving requests. Requests never see the route missing.
+func (r *DynamicRouter) Replace(rt Route) error {
+	return r.replace("", rt)
+}
+
+func (r *DynamicRouter) replace(host string, rt Route) error {
+	return r.update(func(t *table) error {
+		return t.register(host, rt, true)
+	})
+}
+
+func (r *DynamicRouter) remove(host, method, pattern string) error {
+	segs, err := parsePattern(pattern)
+	if err != nil {
+		return &RouteError{Err: ErrInvalidPattern, Pattern: pattern, Reason: err.Error()}
+	}
+	return r.update(func(t *table) error {
+		if !t.remove(host, segs, []string{strings.ToUpper(method)}) {
+			return &RouteError{Err: ErrUnknownRoute, Pattern: pattern, Reason: "no handler is registered for this path and method"}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,384 @@
+package route
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// kind of a tree node or of a pattern segment
+type nodeKind uint8
+
+const (
+	staticNode nodeKind = iota
+	dynamicNode
+	wildcardNode
+)
+
+// a part of a route pattern
+type segment struct {
+	kind nodeKind
+	// for static segments, the decoded text to match, slashes
+	// included. For dynamic and wildcard ones, the identifier as written
+	value      string
+	name       string
+	constraint constraint
+}
+
+// parsePattern split a pattern into consecutive static, dynamic
+// and wildcard segments. A dynamic or a wildcard segment is always
+// preceded by a static one ending with a slash.
+//
+// Empty parts of the pattern and trailing slashes are ignored,
+// so `api//v1/` and `/api/v1` denote the same node of the tree.
+// The trailing slash is only kept in the canonical pattern.
+func parsePattern(pattern string) ([]segment, error) {
+	if pattern == "" {
+		return nil, errors.New("path cannot be nil")
+	}
+	var parts []string
+	for _, part := range strings.Split(pattern, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return []segment{{kind: staticNode, value: "/"}}, nil
+	}
+	var segs []segment
+	static := ""
+	for i, part := range parts {
+		switch part[0] {
+		case ':':
+			name, c, err := parseDynamic(part)
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs,
+				segment{kind: staticNode, value: static + "/"},
+				segment{kind: dynamicNode, value: part, name: name, constraint: c})
+			static = ""
+		case '*':
+			if i != len(parts)-1 {
+				return nil, errors.New("a wildcard identifier must be the last part of the path")
+			} else if part == "*" {
+				return nil, errors.New("a wildcard identifier must be named")
+			}
+			segs = append(segs,
+				segment{kind: staticNode, value: static + "/"},
+				segment{kind: wildcardNode, value: part, name: part[1:]})
+			static = ""
+		default:
+			static += "/" + part
+		}
+	}
+	if static != "" {
+		segs = append(segs, segment{kind: staticNode, value: static})
+	}
+	return segs, nil
+}
+
+// escape a static part of a pattern the way the
+// paths of the requests to match are escaped
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// internal representation of the routes, as a compressed
+// prefix tree. Static parts of the paths are shared between
+// routes byte by byte, dynamic and wildcard parts always match
+// whole segments and hang below the static node ending with
+// the slash preceding them.
+type node struct {
+	kind nodeKind
+	// for static nodes, the part of the escaped path matched by the
+	// node. For dynamic and wildcard ones, the identifier as written
+	path       string
+	name       string
+	constraint constraint
+	// first byte of the path of each static child,
+	// in the same order than statics
+	indices string
+	statics []*node
+	// dynamic children, in matching order. Constrained ones
+	// come first, in registration order, followed by the
+	// unconstrained one, if any
+	dynamics  []*node
+	wildcard  *node
+	endpoints map[string]*endpoint
+}
+
+func newNode() *node {
+	return &node{}
+}
+
+// insert the segments of a pattern below n and
+// returns the node denoted by the whole pattern.
+//
+// The nodes on the way are copied before being modified, n
+// excepted, so a tree sharing them with n is left untouched.
+func (n *node) insert(segs []segment) (*node, error) {
+	var err error
+	for _, seg := range segs {
+		switch seg.kind {
+		case staticNode:
+			n = n.insertStatic(escapePath(seg.value))
+		case dynamicNode:
+			n, err = n.insertDynamic(seg)
+		case wildcardNode:
+			n, err = n.insertWildcard(seg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// insert a static path below n, splitting the
+// existing static nodes sharing a prefix with it
+func (n *node) insertStatic(path string) *node {
+	for path != "" {
+		i := strings.IndexByte(n.indices, path[0])
+		if i < 0 {
+			child := &node{kind: staticNode, path: path}
+			n.indices += path[:1]
+			n.statics = append(n.statics, child)
+			return child
+		}
+		child := n.statics[i].clone()
+		n.statics[i] = child
+		l := commonPrefix(path, child.path)
+		if l < len(child.path) {
+			split := &node{kind: staticNode, path: child.path[:l], indices: child.path[l : l+1], statics: []*node{child}}
+			child.path = child.path[l:]
+			n.statics[i] = split
+			child = split
+		}
+		path = path[l:]
+		n = child
+	}
+	return n
+}
+
+// If the identifier is dynamic and unconstrained, and if an unconstrained
+// dynamic identifier already exist with another name, an error is returned.
+// Constrained identifiers, like `:id<int>` or `:id{[0-9]+}`, may share a
+// level as long as they are not strictly identical.
+func (n *node) insertDynamic(seg segment) (*node, error) {
+	for i, d := range n.dynamics {
+		if d.path == seg.value {
+			n.dynamics[i] = d.clone()
+			return n.dynamics[i], nil
+		}
+	}
+	child := &node{kind: dynamicNode, path: seg.value, name: seg.name, constraint: seg.constraint}
+	last := len(n.dynamics) - 1
+	if last < 0 || n.dynamics[last].constraint != nil {
+		n.dynamics = append(n.dynamics, child)
+	} else if seg.constraint == nil {
+		return nil, errors.New("a dynamic identifier has already been registered at that level")
+	} else {
+		// the unconstrained identifier must stay the last one
+		n.dynamics = append(n.dynamics[:last], child, n.dynamics[last])
+	}
+	return child, nil
+}
+
+// Only one wildcard name is allowed at a given level
+func (n *node) insertWildcard(seg segment) (*node, error) {
+	if n.wildcard == nil {
+		n.wildcard = &node{kind: wildcardNode, path: seg.value, name: seg.name}
+	} else if n.wildcard.path != seg.value {
+		return nil, errors.New("a wildcard identifier has already been registered at that level")
+	} else {
+		n.wildcard = n.wildcard.clone()
+	}
+	return n.wildcard, nil
+}
+
+// a copy of n that can be modified without modifying n.
+// Its children are still shared with n.
+func (n *node) clone() *node {
+	c := *n
+	c.statics = append([]*node(nil), n.statics...)
+	c.dynamics = append([]*node(nil), n.dynamics...)
+	if n.endpoints != nil {
+		c.endpoints = make(map[string]*endpoint, len(n.endpoints))
+		for m, e := range n.endpoints {
+			c.endpoints[m] = e
+		}
+	}
+	return &c
+}
+
+// register e for each of the methods on n
+func (n *node) setEndpoints(methods []string, e *endpoint) {
+	if n.endpoints == nil {
+		n.endpoints = make(map[string]*endpoint)
+	}
+	for _, m := range methods {
+		n.endpoints[m] = e
+	}
+}
+
+// whether no route is registered below n
+func (n *node) empty() bool {
+	return len(n.endpoints) == 0 && len(n.statics) == 0 && len(n.dynamics) == 0 && n.wildcard == nil
+}
+
+// check whether segs can be inserted below n, without modifying
+// the tree. Returns the node denoted by segs if it already exists,
+// or the node clashing with one of the segments and the reason why.
+func (n *node) check(segs []segment) (existing *node, conflict *node, reason string) {
+	for _, seg := range segs {
+		switch seg.kind {
+		case staticNode:
+			n = n.findStatic(escapePath(seg.value))
+		case dynamicNode:
+			var found *node
+			for _, d := range n.dynamics {
+				if d.path == seg.value {
+					found = d
+				} else if d.constraint == nil && seg.constraint == nil {
+					return nil, d, "a dynamic identifier has already been registered at that level"
+				}
+			}
+			n = found
+		case wildcardNode:
+			if n.wildcard != nil && n.wildcard.path != seg.value {
+				return nil, n.wildcard, "a wildcard identifier has already been registered at that level"
+			}
+			n = n.wildcard
+		}
+		if n == nil {
+			// the remaining segments will be inserted in new nodes
+			return nil, nil, ""
+		}
+	}
+	return n, nil, ""
+}
+
+// look for the node ending exactly at the end of
+// the static path below n, without modifying the tree
+func (n *node) findStatic(path string) *node {
+	for path != "" {
+		c := n.staticChild(path[0])
+		if c == nil || !strings.HasPrefix(path, c.path) {
+			return nil
+		}
+		path = path[len(c.path):]
+		n = c
+	}
+	return n
+}
+
+// the endpoint registered exactly for a method, safe on a nil node
+func (n *node) endpointFor(method string) (*endpoint, bool) {
+	if n == nil {
+		return nil, false
+	}
+	e, ok := n.endpoints[method]
+	return e, ok
+}
+
+// the pattern of the first route found below n
+func (n *node) firstPattern() string {
+	var pattern string
+	n.walk(func(_ string, e *endpoint) {
+		if pattern == "" {
+			pattern = e.info.Pattern
+		}
+	})
+	return pattern
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (n *node) staticChild(c byte) *node {
+	for i := 0; i < len(n.indices); i++ {
+		if n.indices[i] == c {
+			return n.statics[i]
+		}
+	}
+	return nil
+}
+
+// look for the node with endpoints matching path, n being
+// a static node. The dynamic segments are appended to ps.
+//
+// At each level, the children are tried in a fixed order :
+//  1. the static child sharing the next bytes of the path
+//  2. the dynamic children whose constraint accept the segment,
+//     constrained ones first in registration order, then the
+//     unconstrained one
+//  3. the wildcard child, catching all the remaining path
+//
+// When a child matches but nothing below it matches the remaining
+// path, the next one is tried. So the most specific route always wins,
+// and a dead-end never hides a route registered on a less specific child.
+//
+// Returns nil when no endpoint can be found, letting ps untouched.
+// The lookup does not allocate as long as ps has enough capacity.
+func (n *node) match(path string, ps *params) *node {
+	if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+		// a wildcard also matches an empty remaining path,
+		// `/files` matches `/files/*filepath`
+		if n.wildcard != nil && len(path) == len(n.path)-1 && n.path[:len(path)] == path {
+			*ps = append(*ps, param{key: n.wildcard.name})
+			return n.wildcard
+		}
+		return nil
+	}
+	return n.matchChildren(path[len(n.path):], ps)
+}
+
+// look for the node matching the remaining path below n
+func (n *node) matchChildren(path string, ps *params) *node {
+	if path == "" {
+		if len(n.endpoints) > 0 {
+			return n
+		} else if n.wildcard != nil {
+			*ps = append(*ps, param{key: n.wildcard.name})
+			return n.wildcard
+		} else if c := n.staticChild('/'); c != nil {
+			return c.match(path, ps)
+		}
+		return nil
+	}
+	if c := n.staticChild(path[0]); c != nil {
+		if found := c.match(path, ps); found != nil {
+			return found
+		}
+	}
+	if len(n.dynamics) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if value := path[:end]; value != "" {
+			for _, d := range n.dynamics {
+				if d.constraint != nil && !d.constraint.check(value) {
+					continue
+				}
+				mark := len(*ps)
+				*ps = append(*ps, param{key: d.name, value: value})
+				if found := d.matchChildren(path[end:], ps); found != nil {
+					return found
+				}
+				*ps = (*ps)[:mark]
+			}
+		}
+	}
+	if n.wildcard != nil {
+		*ps = append(*ps, param{key: n.wildcard.name, value: path})
+		return n.wildcard
+	}
+	return nil
+}
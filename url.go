@@ -0,0 +1,85 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrUnknownRoute is returned when building the URL of a name
+	// that has not been registered, or when removing a route that
+	// does not exist.
+	ErrUnknownRoute = errors.New("unknown route")
+	// ErrMissingParam is returned when building the URL of a route
+	// without a value for one of its dynamic or wildcard segments.
+	ErrMissingParam = errors.New("missing parameter")
+	// ErrInvalidParam is returned when building the URL of a route
+	// with a value rejected by the constraint of its segment, or
+	// with malformed parameters.
+	ErrInvalidParam = errors.New("invalid parameter")
+)
+
+// a route registered with a name
+type namedRoute struct {
+	pattern string
+	segs    []segment
+	// whether the pattern ends with a slash
+	slash bool
+	// host pattern and endpoint of the route owning the name
+	host     string
+	endpoint *endpoint
+}
+
+// URL builds the path of the route registered with the given name,
+// filling its dynamic and wildcard segments with params, given as
+// key and value pairs:
+//
+//	router.URL("test", "testId", "42") // "/tests/42"
+//
+// The values are escaped, the slashes of a wildcard value excepted.
+// An error is returned when the name is unknown, when a value is
+// missing or rejected by the constraint of its segment. Only the
+// path is built, the host of the route being left to the caller.
+func (r *DynamicRouter) URL(name string, params ...string) (string, error) {
+	nr, ok := r.table().names[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownRoute, name)
+	} else if len(params)%2 != 0 {
+		return "", fmt.Errorf("%w: params must be key and value pairs", ErrInvalidParam)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	var b strings.Builder
+	for _, seg := range nr.segs {
+		if seg.kind == staticNode {
+			b.WriteString(escapePath(seg.value))
+			continue
+		}
+		v, ok := values[seg.name]
+		if !ok {
+			return "", fmt.Errorf("%w: %s of route %s", ErrMissingParam, seg.name, name)
+		}
+		switch seg.kind {
+		case dynamicNode:
+			if v == "" || seg.constraint != nil && !seg.constraint(v) {
+				return "", fmt.Errorf("%w: %s=%q for %s", ErrInvalidParam, seg.name, v, nr.pattern)
+			}
+			b.WriteString(url.PathEscape(v))
+		case wildcardNode:
+			for i, part := range strings.Split(strings.TrimPrefix(v, "/"), "/") {
+				if i > 0 {
+					b.WriteByte('/')
+				}
+				b.WriteString(url.PathEscape(part))
+			}
+		}
+	}
+	if nr.slash {
+		b.WriteByte('/')
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,116 @@
+package route
+
+import (
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	// Host pattern of the route, empty for the default tree
+	Host    string
+	Pattern string
+	// Methods served by the route, sorted.
+	// Empty when it serves every method
+	Methods []string
+	// number of filters, context filters included,
+	// run before the handler
+	Filters int
+	// number of middleware wrapping the route
+	Middleware int
+	Name       string
+	// whether the response is streamed
+	Stream bool
+	Meta   map[string]string
+}
+
+// Walk calls fn for each registered route, ordered by host then
+// pattern then methods. The walk stops at the first error returned
+// by fn, which is returned.
+func (r *DynamicRouter) Walk(fn func(RouteInfo) error) error {
+	for _, info := range r.Routes() {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Routes returns the description of all the registered routes,
+// in the same order as Walk.
+func (r *DynamicRouter) Routes() []RouteInfo {
+	var endpoints []*endpoint
+	seen := make(map[*endpoint]bool)
+	collect := func(_ string, e *endpoint) {
+		if !seen[e] {
+			seen[e] = true
+			endpoints = append(endpoints, e)
+		}
+	}
+	t := r.table()
+	t.root.walk(collect)
+	for _, h := range t.hosts {
+		h.root.walk(collect)
+	}
+	infos := make([]RouteInfo, len(endpoints))
+	for i, e := range endpoints {
+		infos[i] = e.info
+		infos[i].Methods = append([]string(nil), e.info.Methods...)
+		if e.info.Meta != nil {
+			infos[i].Meta = copyMeta(e.info.Meta)
+		}
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		} else if a.Pattern != b.Pattern {
+			return a.Pattern < b.Pattern
+		}
+		return strings.Join(a.Methods, ",") < strings.Join(b.Methods, ",")
+	})
+	return infos
+}
+
+// calls fn for the endpoints of n and of all its descendants,
+// with the method they are registered for
+func (n *node) walk(fn func(string, *endpoint)) {
+	methods := make([]string, 0, len(n.endpoints))
+	for m := range n.endpoints {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	for _, m := range methods {
+		fn(m, n.endpoints[m])
+	}
+	for _, c := range n.statics {
+		c.walk(fn)
+	}
+	for _, c := range n.dynamics {
+		c.walk(fn)
+	}
+	if n.wildcard != nil {
+		n.wildcard.walk(fn)
+	}
+}
+
+// canonical form of a parsed pattern, ending with
+// a slash when the route expects one
+func patternString(segs []segment, slash bool) string {
+	var b strings.Builder
+	for _, seg := range segs {
+		b.WriteString(seg.value)
+	}
+	if slash {
+		b.WriteByte('/')
+	}
+	return b.String()
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	c := make(map[string]string, len(meta))
+	for k, v := range meta {
+		c[k] = v
+	}
+	return c
+}